@@ -0,0 +1,22 @@
+package entities
+
+import "errors"
+
+var (
+	// ErrAlreadySubscribed is returned when backfilling an address that is already subscribed.
+	ErrAlreadySubscribed = errors.New("address is already subscribed")
+	// ErrInvalidStartBlock is returned when a backfill would start after the current block.
+	ErrInvalidStartBlock = errors.New("start block must be between 0 and the current block")
+)
+
+// Backfill is the progress of the scan of the history of an address, from FromBlock to ToBlock.
+type Backfill struct {
+	FromBlock int64 `json:"fromBlock"`
+	ToBlock   int64 `json:"toBlock"`
+	// NextBlock is the first block not scanned yet.
+	NextBlock    int64   `json:"nextBlock"`
+	Progress     float64 `json:"progress"`
+	Transactions int     `json:"transactions"`
+	Done         bool    `json:"done"`
+	LastError    string  `json:"lastError,omitempty"`
+}
@@ -0,0 +1,10 @@
+package entities
+
+// Block holds the subset of an eth_getBlockByNumber result used by the watcher.
+type Block struct {
+	Number       int64
+	Hash         string
+	ParentHash   string
+	Timestamp    int64
+	Transactions []Transaction
+}
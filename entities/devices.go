@@ -0,0 +1,42 @@
+package entities
+
+import "errors"
+
+// Platforms of the devices receiving notifications.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+)
+
+// ErrInvalidDevice is returned when registering a device without a token or with an unknown platform.
+var ErrInvalidDevice = errors.New("device requires a token and a platform, ios or android")
+
+// ErrPlatformUnavailable is returned when registering a device of a platform without a push gateway.
+var ErrPlatformUnavailable = errors.New("no push gateway is configured for the platform")
+
+// Device is a phone notified of the transactions of an address. Locale, such as "en" or "pt-BR",
+// selects the language of its notifications.
+type Device struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+	Locale   string `json:"locale,omitempty"`
+	// RegisteredAt is in unix seconds.
+	RegisteredAt int64 `json:"registeredAt"`
+}
+
+// Notification is a message for one device, sent through the push service of its platform.
+type Notification struct {
+	Token    string            `json:"token"`
+	Platform string            `json:"platform"`
+	Title    string            `json:"title"`
+	Body     string            `json:"body"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// NotificationResult is the outcome of a notification, Invalid tells the token is no longer valid
+// and the device must be forgotten.
+type NotificationResult struct {
+	Token   string `json:"token"`
+	Error   string `json:"error,omitempty"`
+	Invalid bool   `json:"invalid,omitempty"`
+}
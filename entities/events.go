@@ -0,0 +1,72 @@
+package entities
+
+// Types of the events published on the event bus.
+const (
+	EventBlockProcessed      = "blockProcessed"
+	EventTransactionMatched  = "transactionMatched"
+	EventTransactionReverted = "transactionReverted"
+	EventSubscriptionAdded   = "subscriptionAdded"
+)
+
+// Event is published on the event bus, its type selects the subscribers it is delivered to.
+type Event interface {
+	EventType() string
+}
+
+// BlockProcessed is published once the transactions of a block were matched and stored.
+type BlockProcessed struct {
+	Block Block
+}
+
+// TransactionMatched carries the transactions of an address found in a block, by the watcher or a backfill.
+type TransactionMatched struct {
+	Address      string
+	Transactions []Transaction
+	Backfill     bool
+}
+
+// TransactionReverted carries the reverted copies of transactions of an address orphaned by a reorg.
+type TransactionReverted struct {
+	Address      string
+	Transactions []Transaction
+}
+
+// SubscriptionAdded is published when a consumer subscribes to an address, StartBlock is the first
+// block watched when the address is new.
+type SubscriptionAdded struct {
+	Address    string
+	Consumer   string
+	StartBlock int64
+}
+
+func (BlockProcessed) EventType() string      { return EventBlockProcessed }
+func (TransactionMatched) EventType() string  { return EventTransactionMatched }
+func (TransactionReverted) EventType() string { return EventTransactionReverted }
+func (SubscriptionAdded) EventType() string   { return EventSubscriptionAdded }
+
+// EventStats reports the events counted by type by the metrics subscriber, and the delivery to every
+// subscriber of the bus.
+type EventStats struct {
+	Events        map[string]uint64      `json:"events"`
+	Subscribers   []EventSubscriberStats `json:"subscribers"`
+	Notifications *NotificationStats     `json:"notifications,omitempty"`
+}
+
+// NotificationStats counts the notification batches handed to the push gateways. Failed batches were
+// given up after their retries, along with the notifications they held.
+type NotificationStats struct {
+	BatchesSent         uint64 `json:"batchesSent"`
+	BatchesFailed       uint64 `json:"batchesFailed"`
+	NotificationsFailed uint64 `json:"notificationsFailed"`
+}
+
+// EventSubscriberStats reports the delivery of the events to one subscriber. Failed events were
+// given up after their handler kept failing, dropped ones were never handled because its queue was full.
+type EventSubscriberStats struct {
+	Name      string `json:"name"`
+	Mode      string `json:"mode"`
+	Queued    int    `json:"queued"`
+	Delivered uint64 `json:"delivered"`
+	Failed    uint64 `json:"failed"`
+	Dropped   uint64 `json:"dropped"`
+}
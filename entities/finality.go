@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	FinalityLatest    = "latest"
+	FinalitySafe      = "safe"
+	FinalityFinalized = "finalized"
+)
+
+// Finality describes how settled a transaction must be before it is reported, either as
+// a number of confirmations or as one of the node's block tags.
+type Finality struct {
+	Confirmations int64
+	Tag           string
+}
+
+// ParseFinality accepts a confirmation count ("12") or a block tag ("latest", "safe", "finalized").
+// An empty value gives the zero Finality, which stands for the service default. Zero confirmations
+// require nothing more than the latest block, so "0" gives the latest tag rather than the default.
+func ParseFinality(value string) (Finality, error) {
+	switch value {
+	case "":
+		return Finality{}, nil
+	case FinalityLatest, FinalitySafe, FinalityFinalized:
+		return Finality{Tag: value}, nil
+	}
+
+	confirmations, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || confirmations < 0 {
+		return Finality{}, fmt.Errorf("invalid finality %q, expected a confirmation count or one of latest, safe, finalized", value)
+	}
+	if confirmations == 0 {
+		return Finality{Tag: FinalityLatest}, nil
+	}
+	return Finality{Confirmations: confirmations}, nil
+}
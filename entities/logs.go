@@ -0,0 +1,12 @@
+package entities
+
+// Log is an event emitted by a contract, as returned by eth_getLogs.
+type Log struct {
+	Address         string
+	Topics          []string
+	Data            string
+	BlockNumber     int64
+	BlockHash       string
+	TransactionHash string
+	LogIndex        uint64
+}
@@ -0,0 +1,19 @@
+package entities
+
+const (
+	PendingStatePending  = "pending"
+	PendingStateMined    = "mined"
+	PendingStateReplaced = "replaced"
+	PendingStateDropped  = "dropped"
+)
+
+// PendingTransaction is a transaction of a subscribed address seen in the mempool, and what became
+// of it. A replaced transaction lost its nonce to ReplacedBy, which sped it up or cancelled it.
+type PendingTransaction struct {
+	Transaction
+	State string `json:"state"`
+	// FirstSeen and SettledAt are unix seconds, SettledAt is set once the transaction left the pending state.
+	FirstSeen  int64  `json:"firstSeen"`
+	SettledAt  int64  `json:"settledAt,omitempty"`
+	ReplacedBy string `json:"replacedBy,omitempty"`
+}
@@ -0,0 +1,32 @@
+package entities
+
+// ProviderHealth is the health snapshot of one RPC provider.
+type ProviderHealth struct {
+	URL                 string  `json:"url"`
+	Healthy             bool    `json:"healthy"`
+	LatencyMs           float64 `json:"latencyMs"`
+	ErrorRate           float64 `json:"errorRate"`
+	Head                int64   `json:"head"`
+	HeadLag             int64   `json:"headLag"`
+	Requests            int64   `json:"requests"`
+	Failures            int64   `json:"failures"`
+	ConsecutiveFailures int64   `json:"consecutiveFailures"`
+	Circuit             string  `json:"circuit"`
+	LastError           string  `json:"lastError,omitempty"`
+	// Tracer is the tracing API of the provider, empty when it is not used for tracing.
+	Tracer string `json:"tracer,omitempty"`
+	// RateLimit is only set for providers with a request budget.
+	RateLimit *RateLimitUsage `json:"rateLimit,omitempty"`
+}
+
+// RateLimitUsage shows how much of its request budget a provider is using.
+type RateLimitUsage struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+	AvailableTokens   float64 `json:"availableTokens"`
+	DailyQuota        int64   `json:"dailyQuota,omitempty"`
+	DailyUsed         int64   `json:"dailyUsed"`
+	QuotaUsedPercent  float64 `json:"quotaUsedPercent,omitempty"`
+	WaitingTip        int     `json:"waitingTip"`
+	WaitingBackfill   int     `json:"waitingBackfill"`
+}
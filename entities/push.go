@@ -0,0 +1,39 @@
+package entities
+
+import "encoding/json"
+
+// Types of the messages of the WebSocket push API, the first four are sent by clients.
+const (
+	PushTypeSubscribe   = "subscribe"
+	PushTypeUnsubscribe = "unsubscribe"
+	PushTypeAck         = "ack"
+	PushTypePing        = "ping"
+	PushTypePong        = "pong"
+	PushTypeResult      = "result"
+	PushTypeError       = "error"
+	PushTypeTransaction = "transaction"
+)
+
+// PushRequest is a message sent by a client of the WebSocket push API. ID is optional and echoed in
+// the reply. Subscribe and unsubscribe take Addresses, ack takes Address and Sequence.
+type PushRequest struct {
+	ID        json.RawMessage `json:"id,omitempty"`
+	Type      string          `json:"type"`
+	Addresses []string        `json:"addresses,omitempty"`
+	Address   string          `json:"address,omitempty"`
+	Consumer  string          `json:"consumer,omitempty"`
+	// Finality and Cursor have the meaning of the /transactions parameters.
+	Finality string `json:"finality,omitempty"`
+	Cursor   uint64 `json:"cursor,omitempty"`
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+// PushMessage is a message sent to a client of the WebSocket push API, either the reply to a request
+// or a transaction of one of the addresses it subscribed to.
+type PushMessage struct {
+	ID          json.RawMessage `json:"id,omitempty"`
+	Type        string          `json:"type"`
+	Address     string          `json:"address,omitempty"`
+	Transaction *Transaction    `json:"transaction,omitempty"`
+	Error       string          `json:"error,omitempty"`
+}
@@ -0,0 +1,19 @@
+package entities
+
+const (
+	ExecutionStatusSuccess = "success"
+	ExecutionStatusFailed  = "failed"
+)
+
+// Receipt holds the outcome of a transaction once it was included in a block.
+type Receipt struct {
+	TransactionHash string
+	BlockHash       string
+	// Status is ExecutionStatusSuccess or ExecutionStatusFailed, or empty for blocks older than Byzantium.
+	Status            string
+	GasUsed           uint64
+	EffectiveGasPrice string
+	BlobGasUsed       uint64
+	BlobGasPrice      string
+	ContractAddress   string
+}
@@ -0,0 +1,38 @@
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RPCCall is a single JSON-RPC call sent as part of a batch.
+type RPCCall struct {
+	Method string
+	Params []interface{}
+}
+
+// RPCError is the error object of a JSON-RPC response.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (Code: %d)", e.Message, e.Code)
+}
+
+// RPCResult is the outcome of one call of a batch, in the same position as the call.
+type RPCResult struct {
+	Result json.RawMessage
+	Error  *RPCError
+}
+
+// Priority is the lane an outbound RPC call waits in when a provider is rate limited.
+type Priority int
+
+const (
+	// PriorityTip is used to follow the chain head and always goes first.
+	PriorityTip Priority = iota
+	// PriorityBackfill is used for historical ranges and yields to tip-following calls.
+	PriorityBackfill
+)
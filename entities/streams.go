@@ -0,0 +1,24 @@
+package entities
+
+import "errors"
+
+// DefaultConsumer is the consumer of the clients that do not name one.
+const DefaultConsumer = ""
+
+var (
+	// ErrStreamNotFound is returned when acknowledging an address that never had a transaction stored.
+	ErrStreamNotFound = errors.New("no transactions were stored for this address")
+	// ErrSequenceNotAssigned is returned when acknowledging a sequence beyond the last stored transaction.
+	ErrSequenceNotAssigned = errors.New("sequence was not assigned yet")
+	// ErrConsumerNotFound is returned when reading or acknowledging for a consumer never subscribed.
+	ErrConsumerNotFound = errors.New("consumer is not subscribed to this address")
+)
+
+// Stream tracks the delivery of the transactions stored for an address.
+type Stream struct {
+	// LastSequence is the sequence of the last transaction stored, removed ones included.
+	LastSequence uint64 `json:"lastSequence"`
+	// Consumers maps each consumer of the address to the sequence it acknowledged. Transactions are
+	// removed once every consumer acknowledged them. Without consumers only DefaultConsumer exists.
+	Consumers map[string]uint64 `json:"consumers,omitempty"`
+}
@@ -0,0 +1,105 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	// ErrSubscriptionNotFound is returned when looking up an address that is not subscribed.
+	ErrSubscriptionNotFound = errors.New("address is not subscribed")
+	// ErrTooManySubscriptions is returned when subscribing a new address while the limit is reached.
+	ErrTooManySubscriptions = errors.New("the maximum number of subscribed addresses is reached")
+)
+
+// Subscription describes a subscribed address and how far behind the chain head its scan is.
+type Subscription struct {
+	Address          string          `json:"address"`
+	LastCheckedBlock int64           `json:"lastCheckedBlock"`
+	Lag              int64           `json:"lag"`
+	LastSequence     uint64          `json:"lastSequence"`
+	Consumers        []ConsumerState `json:"consumers"`
+	Backfill         *Backfill       `json:"backfill,omitempty"`
+}
+
+// ConsumerState is the delivery progress of one consumer of an address.
+type ConsumerState struct {
+	Name         string `json:"name"`
+	Acknowledged uint64 `json:"acknowledged"`
+}
+
+// SubscriptionChange is one entry of a bulk subscribe or unsubscribe.
+type SubscriptionChange struct {
+	Address  string `json:"address"`
+	Consumer string `json:"consumer,omitempty"`
+}
+
+// SubscriptionChangeResult reports whether a SubscriptionChange changed anything, or why it failed.
+type SubscriptionChangeResult struct {
+	SubscriptionChange
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ParseSubscriptionChanges reads a JSON array of addresses or of {"address", "consumer"} objects, or
+// CSV lines of address and optional consumer with an optional "address" header.
+func ParseSubscriptionChanges(data []byte) ([]SubscriptionChange, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseSubscriptionChangesJSON(trimmed)
+	}
+	return parseSubscriptionChangesCSV(trimmed)
+}
+
+func parseSubscriptionChangesJSON(data []byte) ([]SubscriptionChange, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	changes := make([]SubscriptionChange, 0, len(entries))
+	for i, entry := range entries {
+		var change SubscriptionChange
+		if err := json.Unmarshal(entry, &change.Address); err != nil {
+			if err := json.Unmarshal(entry, &change); err != nil {
+				return nil, fmt.Errorf("entry %d: expected an address or an object with an address", i+1)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func parseSubscriptionChangesCSV(data []byte) ([]SubscriptionChange, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var changes []SubscriptionChange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return changes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(record) > 2 {
+			return nil, fmt.Errorf("line %d: expected address and optional consumer", line)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue
+		}
+
+		change := SubscriptionChange{Address: strings.TrimSpace(record[0])}
+		if len(record) == 2 {
+			change.Consumer = strings.TrimSpace(record[1])
+		}
+		changes = append(changes, change)
+	}
+}
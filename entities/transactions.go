@@ -1,8 +1,92 @@
 package entities
 
+// TransactionStatusReverted marks a transaction that was delivered from a block later orphaned by a reorg.
+const TransactionStatusReverted = "reverted"
+
+const (
+	TransactionKindNative  = "native"
+	TransactionKindERC20   = "erc20"
+	TransactionKindERC721  = "erc721"
+	TransactionKindERC1155 = "erc1155"
+	// TransactionKindInternal is ether sent by a contract, as found by tracing the transaction.
+	TransactionKindInternal = "internal"
+)
+
+// Transaction is a transaction involving a subscribed address. Value stays the raw hex quantity
+// returned by the node, amounts in wei are also given as decimal strings since they overflow int64.
 type Transaction struct {
-	From  string `json:"from"`
-	To    string `json:"to"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	Hash          string `json:"hash"`
+	BlockNumber   int64  `json:"blockNumber"`
+	Confirmations int64  `json:"confirmations"`
+	Status        string `json:"status,omitempty"`
+	// Kind tells a transfer of ether from a token transfer, which is described by Token.
+	Kind     string            `json:"kind,omitempty"`
+	Token    *TokenTransfer    `json:"token,omitempty"`
+	Internal *InternalTransfer `json:"internal,omitempty"`
+
+	ValueWei         string `json:"valueWei,omitempty"`
+	BlockHash        string `json:"blockHash,omitempty"`
+	TransactionIndex int64  `json:"transactionIndex"`
+	// Timestamp is when the block was mined, in unix seconds.
+	Timestamp            int64  `json:"timestamp,omitempty"`
+	Nonce                uint64 `json:"nonce"`
+	Gas                  uint64 `json:"gas"`
+	GasPrice             string `json:"gasPrice,omitempty"`
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+	// Type is the EIP-2718 type: 0 for legacy, 1 for access lists, 2 for EIP-1559 and 3 for blobs.
+	Type    uint64 `json:"type"`
+	ChainID uint64 `json:"chainId,omitempty"`
+	Input   string `json:"input,omitempty"`
+	// ContractCreation is set for transactions without a recipient, which deploy a contract.
+	ContractCreation bool `json:"contractCreation,omitempty"`
+
+	// ExecutionStatus comes from the receipt, a failed transaction changed nothing but still paid its fee.
+	ExecutionStatus   string `json:"executionStatus,omitempty"`
+	GasUsed           uint64 `json:"gasUsed,omitempty"`
+	EffectiveGasPrice string `json:"effectiveGasPrice,omitempty"`
+	// Fee is the amount in wei paid for gas, blob gas included.
+	Fee string `json:"fee,omitempty"`
+	// ContractAddress is the address of the contract deployed by a contract creation.
+	ContractAddress string `json:"contractAddress,omitempty"`
+
+	// Sequence orders the transactions stored for an address, it only ever increases.
+	Sequence uint64 `json:"sequence"`
+}
+
+// TokenTransfer is a transfer reported by a token contract in an event log. From and To are the holders
+// of the tokens, while the Transaction carrying it may have been sent by anyone.
+type TokenTransfer struct {
+	Contract string `json:"contract"`
+	// Operator moved the tokens of From on its behalf, only ERC-1155 contracts report it.
+	Operator string `json:"operator,omitempty"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	// TokenID identifies the NFT moved, as a decimal string.
+	TokenID string `json:"tokenId,omitempty"`
+	// Amount is given in the smallest unit of the token as a decimal string, it is 1 for ERC-721 tokens.
+	Amount   string `json:"amount"`
+	LogIndex uint64 `json:"logIndex"`
+}
+
+const (
+	InternalTransferCall         = "call"
+	InternalTransferCreate       = "create"
+	InternalTransferSelfDestruct = "selfdestruct"
+)
+
+// InternalTransfer is ether moved by a contract during a transaction, by a call, by creating another
+// contract or by self-destructing.
+type InternalTransfer struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Value is given in wei as a decimal string.
 	Value string `json:"value"`
-	Hash  string `json:"hash"`
+	// Index is the position of the call in the call tree of the transaction visited depth first, where
+	// the transaction itself is 0.
+	Index int `json:"index"`
 }
@@ -0,0 +1,59 @@
+package entities
+
+import "errors"
+
+var (
+	// ErrInvalidWebhook is returned when registering a webhook without an http(s) URL of a public host,
+	// or without a secret.
+	ErrInvalidWebhook = errors.New("webhook requires an http or https url and a secret")
+	// ErrWebhookNotFound is returned when looking up a webhook that is not registered.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDeadLetterNotFound is returned when replaying a dead letter that does not exist.
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// Webhook pushes the transactions of a consumer of an address to URL, which acknowledges them by
+// answering with a 2xx status. Failures counts the attempts of the payload being retried, if any.
+type Webhook struct {
+	Address  string `json:"address"`
+	Consumer string `json:"consumer"`
+	URL      string `json:"url"`
+	// Secret signs the payloads, it is never returned by the API.
+	Secret string `json:"secret,omitempty"`
+	// Attempts lists the latest deliveries, oldest first.
+	Attempts    []DeliveryAttempt `json:"attempts,omitempty"`
+	Failures    int               `json:"failures,omitempty"`
+	NextAttempt int64             `json:"nextAttempt,omitempty"`
+	// Retrying is the payload that failed last, sent again as is until it is accepted or parked.
+	Retrying *WebhookPayload `json:"retrying,omitempty"`
+}
+
+// DeliveryAttempt is one POST of a webhook payload, Error is empty when it was accepted.
+type DeliveryAttempt struct {
+	PayloadID string `json:"payloadId"`
+	// At is when the attempt was made, in unix seconds.
+	At         int64  `json:"at"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WebhookPayload is the body POSTed to a webhook. ID stays the same across the retries of a delivery,
+// so receivers can ignore a payload they already processed.
+type WebhookPayload struct {
+	ID           string        `json:"id"`
+	Address      string        `json:"address"`
+	Consumer     string        `json:"consumer,omitempty"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// DeadLetter is a webhook payload parked after every attempt to deliver it failed, until it is replayed.
+type DeadLetter struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret is the secret of the webhook when the payload failed, it is never returned by the API.
+	Secret   string            `json:"secret,omitempty"`
+	Payload  WebhookPayload    `json:"payload"`
+	Attempts []DeliveryAttempt `json:"attempts"`
+	// FailedAt is when the payload was parked, in unix seconds.
+	FailedAt int64 `json:"failedAt"`
+}
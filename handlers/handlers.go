@@ -2,10 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/websockets"
+)
+
+const (
+	maxBulkUploadSize = 10 << 20         // Bounds the size of a bulk subscribe or unsubscribe upload
+	streamHeartbeat   = 15 * time.Second // Time between comments keeping an idle event stream open
+	streamRetryMillis = 5000             // Reconnection delay advertised to event stream clients
+	streamEvent       = "transaction"    // Type of the events carrying a transaction
 )
 
 func HandleCurrentBlock(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
@@ -26,8 +41,15 @@ func HandleSubscribe(w http.ResponseWriter, r *http.Request, rpc interfaces.Pars
 		return
 	}
 
+	// Consumer is optional, several named consumers read the transactions of an address independently.
+	// FromBlock, or FromTimestamp in unix seconds, also delivers the history of a new address.
+	// Webhook pushes the transactions of the consumer instead of waiting for it to read them.
 	var data struct {
-		Address string `json:"address"`
+		Address       string       `json:"address"`
+		Consumer      string       `json:"consumer"`
+		FromBlock     *int64       `json:"fromBlock"`
+		FromTimestamp *int64       `json:"fromTimestamp"`
+		Webhook       *webhookData `json:"webhook"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
@@ -40,7 +62,40 @@ func HandleSubscribe(w http.ResponseWriter, r *http.Request, rpc interfaces.Pars
 		return
 	}
 
-	if rpc.Subscribe(data.Address) {
+	if data.FromBlock != nil && data.FromTimestamp != nil {
+		http.Error(w, "Only one of fromBlock and fromTimestamp can be given", http.StatusBadRequest)
+		return
+	}
+	if data.FromTimestamp != nil {
+		fromBlock, err := rpc.GetBlockNumberByTimestamp(*data.FromTimestamp)
+		if errors.Is(err, entities.ErrInvalidStartBlock) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to resolve fromTimestamp: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		data.FromBlock = &fromBlock
+	}
+	if data.FromBlock != nil {
+		handleSubscribeFromBlock(w, rpc, data.Address, data.Consumer, *data.FromBlock, data.Webhook)
+		return
+	}
+
+	subscribed, err := rpc.SubscribeConsumer(data.Address, data.Consumer)
+	switch {
+	case errors.Is(err, entities.ErrTooManySubscriptions):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, "Failed to subscribe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !setWebhook(w, rpc, data.Address, data.Consumer, data.Webhook) {
+		return
+	}
+	if subscribed {
 		_, err := fmt.Fprintf(w, "Subscribed to: %s", data.Address)
 		if err != nil {
 			return
@@ -53,16 +108,220 @@ func HandleSubscribe(w http.ResponseWriter, r *http.Request, rpc interfaces.Pars
 	}
 }
 
+func handleSubscribeFromBlock(w http.ResponseWriter, rpc interfaces.Parser, address string, consumer string, fromBlock int64, webhook *webhookData) {
+	_, err := rpc.SubscribeFromBlock(address, consumer, fromBlock)
+	switch {
+	case errors.Is(err, entities.ErrAlreadySubscribed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, entities.ErrInvalidStartBlock):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, entities.ErrTooManySubscriptions):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, "Failed to subscribe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !setWebhook(w, rpc, address, consumer, webhook) {
+		return
+	}
+
+	_, err = fmt.Fprintf(w, "Subscribed to: %s, backfilling from block %d", address, fromBlock)
+	if err != nil {
+		return
+	}
+}
+
+type webhookData struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// setWebhook registers webhook, when given, for a consumer that was just subscribed. It reports whether
+// the request can go on, answering it otherwise.
+func setWebhook(w http.ResponseWriter, rpc interfaces.Parser, address string, consumer string, webhook *webhookData) bool {
+	if webhook == nil {
+		return true
+	}
+	err := rpc.SetWebhook(address, consumer, webhook.URL, webhook.Secret)
+	switch {
+	case errors.Is(err, entities.ErrInvalidWebhook):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	case err != nil:
+		http.Error(w, "Failed to set webhook: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// HandleUnsubscribe removes a consumer of an address, or the whole address when no consumer is given.
+func HandleUnsubscribe(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Address  string `json:"address"`
+		Consumer string `json:"consumer"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if data.Address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	var removed bool
+	if data.Consumer == "" {
+		removed = rpc.Unsubscribe(data.Address)
+	} else {
+		removed = rpc.UnsubscribeConsumer(data.Address, data.Consumer)
+	}
+	if !removed {
+		http.Error(w, "Not subscribed to: "+data.Address, http.StatusNotFound)
+		return
+	}
+
+	_, err := fmt.Fprintf(w, "Unsubscribed from: %s", data.Address)
+	if err != nil {
+		return
+	}
+}
+
+// HandleSubscriptions lists every subscription, or describes the one at /subscriptions/<address>.
+func HandleSubscriptions(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var result interface{}
+	var err error
+	if address := strings.Trim(strings.TrimPrefix(r.URL.Path, "/subscriptions"), "/"); address != "" {
+		result, err = rpc.GetSubscription(address)
+	} else {
+		result, err = rpc.GetSubscriptions()
+	}
+	if errors.Is(err, entities.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to load subscriptions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	js, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, "Failed to serialize subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(js)
+	if err != nil {
+		return
+	}
+}
+
+// HandleBulkSubscribe subscribes every address of a JSON or CSV upload.
+func HandleBulkSubscribe(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	handleBulk(w, r, rpc.SubscribeAll)
+}
+
+// HandleBulkUnsubscribe unsubscribes every address of a JSON or CSV upload.
+func HandleBulkUnsubscribe(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	handleBulk(w, r, rpc.UnsubscribeAll)
+}
+
+// handleBulk reads the changes from the request body, or from its "file" field when it is a
+// multipart form, and responds with the result of each one.
+func handleBulk(w http.ResponseWriter, r *http.Request, apply func([]entities.SubscriptionChange) []entities.SubscriptionChangeResult) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkUploadSize)
+	var upload io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "A file field is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		upload = file
+	}
+
+	data, err := io.ReadAll(upload)
+	if err != nil {
+		http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	changes, err := entities.ParseSubscriptionChanges(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(changes) == 0 {
+		http.Error(w, "No addresses found in upload", http.StatusBadRequest)
+		return
+	}
+
+	js, err := json.Marshal(apply(changes))
+	if err != nil {
+		http.Error(w, "Failed to serialize results", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(js)
+	if err != nil {
+		return
+	}
+}
+
 func HandleTransactions(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
 	address := r.URL.Query().Get("address")
-	transactions, err := rpc.GetTransactions(address)
-	w.Header().Set("Content-Type", "application/json")
 
-	if len(transactions) > 0 {
-		// Clean up transactions after sending
-		rpc.CleanUpTransactions(address)
+	// Without a cursor, transactions are returned from the last acknowledged one
+	var cursor uint64
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		parsed, parseErr := strconv.ParseUint(value, 10, 64)
+		if parseErr != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	// Without an explicit finality the service default is used
+	var finality entities.Finality
+	if value := r.URL.Query().Get("finality"); value != "" {
+		parsed, parseErr := entities.ParseFinality(value)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		finality = parsed
 	}
 
+	transactions, err := rpc.GetTransactionsAfter(address, r.URL.Query().Get("consumer"), cursor, finality)
+	if errors.Is(err, entities.ErrConsumerNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
 	if len(transactions) == 0 {
 		// Respond with a predefined message when no transactions are found
 		noTransactionsResponse, _ := json.Marshal(map[string]string{
@@ -96,3 +355,456 @@ func HandleTransactions(w http.ResponseWriter, r *http.Request, rpc interfaces.P
 		return
 	}
 }
+
+// HandleTransactionStream pushes the transactions of an address as Server-Sent Events while they are
+// stored, each with its sequence as event id. It starts after the Last-Event-ID header sent by
+// reconnecting clients, or after the cursor parameter, and never acknowledges anything.
+func HandleTransactionStream(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Missing address", http.StatusBadRequest)
+		return
+	}
+	consumer := r.URL.Query().Get("consumer")
+
+	var cursor uint64
+	for _, value := range []string{r.URL.Query().Get("cursor"), r.Header.Get("Last-Event-ID")} {
+		if value == "" {
+			continue
+		}
+		parsed, parseErr := strconv.ParseUint(value, 10, 64)
+		if parseErr != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		cursor = parsed
+	}
+
+	var finality entities.Finality
+	if value := r.URL.Query().Get("finality"); value != "" {
+		parsed, parseErr := entities.ParseFinality(value)
+		if parseErr != nil {
+			http.Error(w, parseErr.Error(), http.StatusBadRequest)
+			return
+		}
+		finality = parsed
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	if _, err := rpc.GetSubscription(address); errors.Is(err, entities.ErrSubscriptionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Watch before the first read so nothing stored in between is missed
+	signal, stop := rpc.WatchTransactions(address)
+	defer stop()
+
+	transactions, err := rpc.GetTransactionsAfter(address, consumer, cursor, finality)
+	if errors.Is(err, entities.ErrConsumerNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		for _, tx := range transactions {
+			js, err := json.Marshal(tx)
+			if err != nil {
+				fmt.Printf("Error serializing transaction %s: %v\n", tx.Hash, err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", tx.Sequence, streamEvent, js); err != nil {
+				return
+			}
+			cursor = tx.Sequence
+		}
+		if len(transactions) > 0 {
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			transactions = nil
+			continue
+		case <-signal:
+		}
+
+		transactions, err = rpc.GetTransactionsAfter(address, consumer, cursor, finality)
+		if errors.Is(err, entities.ErrConsumerNotFound) {
+			// The consumer was unsubscribed, there is nothing left to stream
+			return
+		}
+	}
+}
+
+// HandlePushSocket upgrades the request to a WebSocket speaking the push API, which multiplexes the
+// transactions of every address the client subscribes to over the connection.
+func HandlePushSocket(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	conn, err := websockets.Upgrade(w, r)
+	if err != nil {
+		// Upgrade already answered the request
+		return
+	}
+	services.ServePushSession(conn, rpc)
+}
+
+// HandleAcknowledge removes the transactions of an address up to the acknowledged sequence.
+func HandleAcknowledge(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Address  string `json:"address"`
+		Consumer string `json:"consumer"`
+		Sequence uint64 `json:"sequence"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if data.Address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	err := rpc.AcknowledgeTransactions(data.Address, data.Consumer, data.Sequence)
+	switch {
+	case errors.Is(err, entities.ErrStreamNotFound), errors.Is(err, entities.ErrConsumerNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, entities.ErrSequenceNotAssigned):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Failed to acknowledge transactions", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = fmt.Fprintf(w, "Acknowledged transactions of %s up to sequence %d", data.Address, data.Sequence)
+	if err != nil {
+		return
+	}
+}
+
+// HandlePendingTransactions lists the mempool transactions of an address with their lifecycle state.
+func HandlePendingTransactions(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Missing address", http.StatusBadRequest)
+		return
+	}
+
+	pending, err := rpc.GetPendingTransactions(address)
+	if err != nil {
+		http.Error(w, "Failed to load pending transactions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	js, err := json.Marshal(pending)
+	if err != nil {
+		http.Error(w, "Failed to serialize pending transactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(js)
+	if err != nil {
+		return
+	}
+}
+
+// HandleDevices lists the devices notified of an address, registers one with POST, and unregisters one
+// with DELETE, from every address when none is given.
+func HandleDevices(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	switch r.Method {
+	case http.MethodGet:
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			http.Error(w, "Missing address", http.StatusBadRequest)
+			return
+		}
+		devices, err := rpc.GetDevices(address)
+		if err != nil {
+			http.Error(w, "Failed to load devices: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		js, err := json.Marshal(devices)
+		if err != nil {
+			http.Error(w, "Failed to serialize devices", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(js)
+		if err != nil {
+			return
+		}
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Address  string `json:"address"`
+		Token    string `json:"token"`
+		Platform string `json:"platform"`
+		Locale   string `json:"locale"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if data.Token == "" {
+			http.Error(w, "Token is required", http.StatusBadRequest)
+			return
+		}
+		removed, err := rpc.UnregisterDevice(data.Address, data.Token)
+		if err != nil {
+			http.Error(w, "Failed to unregister device: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, "Device not registered", http.StatusNotFound)
+			return
+		}
+		_, err = fmt.Fprint(w, "Device unregistered")
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	if data.Address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+	err := rpc.RegisterDevice(data.Address, entities.Device{Token: data.Token, Platform: data.Platform, Locale: data.Locale})
+	switch {
+	case errors.Is(err, entities.ErrInvalidDevice), errors.Is(err, entities.ErrPlatformUnavailable):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, entities.ErrSubscriptionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to register device: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = fmt.Fprintf(w, "Device registered for: %s", data.Address)
+	if err != nil {
+		return
+	}
+}
+
+// HandleMetrics reports the events of the event bus and their delivery to its subscribers.
+func HandleMetrics(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	js, err := json.Marshal(rpc.GetEventStats())
+	if err != nil {
+		http.Error(w, "Failed to serialize metrics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(js)
+	if err != nil {
+		return
+	}
+}
+
+func HandleProviders(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	js, err := json.Marshal(rpc.GetProviderHealth())
+	if err != nil {
+		http.Error(w, "Failed to serialize provider health", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(js)
+	if err != nil {
+		return
+	}
+}
+
+// HandleWebhooks lists the webhooks, of an address when given, registers one with POST, and removes one with DELETE.
+func HandleWebhooks(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	switch r.Method {
+	case http.MethodGet:
+		webhooks, err := rpc.GetWebhooks(r.URL.Query().Get("address"))
+		if err != nil {
+			http.Error(w, "Failed to load webhooks: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		js, err := json.Marshal(webhooks)
+		if err != nil {
+			http.Error(w, "Failed to serialize webhooks", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(js)
+		if err != nil {
+			return
+		}
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		Address  string `json:"address"`
+		Consumer string `json:"consumer"`
+		webhookData
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if data.Address == "" {
+		http.Error(w, "Address is required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		removed, err := rpc.RemoveWebhook(data.Address, data.Consumer)
+		if err != nil {
+			http.Error(w, "Failed to remove webhook: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, entities.ErrWebhookNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		_, err = fmt.Fprintf(w, "Removed webhook of: %s", data.Address)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	err := rpc.SetWebhook(data.Address, data.Consumer, data.URL, data.Secret)
+	switch {
+	case errors.Is(err, entities.ErrInvalidWebhook):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, entities.ErrConsumerNotFound), errors.Is(err, entities.ErrStreamNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to set webhook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = fmt.Fprintf(w, "Webhook set for: %s", data.Address)
+	if err != nil {
+		return
+	}
+}
+
+// HandleDeadLetters lists the webhook payloads that could not be delivered.
+func HandleDeadLetters(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deadLetters, err := rpc.GetDeadLetters()
+	if err != nil {
+		http.Error(w, "Failed to load dead letters: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	js, err := json.Marshal(deadLetters)
+	if err != nil {
+		http.Error(w, "Failed to serialize dead letters", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(js)
+	if err != nil {
+		return
+	}
+}
+
+// HandleReplayDeadLetter sends a dead letter to its webhook again, and forgets it once delivered.
+func HandleReplayDeadLetter(w http.ResponseWriter, r *http.Request, rpc interfaces.Parser) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var data struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	err := rpc.ReplayDeadLetter(data.ID)
+	switch {
+	case errors.Is(err, entities.ErrDeadLetterNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	_, err = fmt.Fprintf(w, "Replayed: %s", data.ID)
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleSubscribeAtTheSubscriptionLimit(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	rpc := &services.EthereumRPC{
+		Storage:          storages.NewMemoryStorage(),
+		Methods:          mockClient,
+		MaxSubscriptions: 1,
+	}
+	subscribe := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		HandleSubscribe(recorder, httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(body)), rpc)
+		return recorder
+	}
+
+	recorder := subscribe(`{"address":"0x123"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "Subscribed to: 0x123", recorder.Body.String())
+
+	recorder = subscribe(`{"address":"0x456"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code, "addresses beyond the limit are refused")
+	assert.Contains(t, recorder.Body.String(), "maximum number of subscribed addresses")
+	_, subscribed, _ := rpc.Storage.Subscriptions.Find("0x456")
+	assert.False(t, subscribed)
+
+	recorder = subscribe(`{"address":"0x123","consumer":"analytics"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code, "consumers of subscribed addresses do not count")
+}
@@ -6,25 +6,102 @@ import (
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
 )
 
-// Storage defines the CRUD operations.
-type Storage interface {
-	Save(key string, value interface{})
-	Delete(key string)
-	Find(key string) (interface{}, bool)
-	Update(key string, value interface{})
-	GetAll() interface{}
+// Storage defines the CRUD operations of a typed key-value store.
+type Storage[K comparable, V any] interface {
+	Save(key K, value V) error
+	Delete(key K) error
+	Find(key K) (V, bool, error)
+	// Update replaces the value of an existing key, it never creates one.
+	Update(key K, value V) error
+	GetAll() (map[K]V, error)
+	// Range calls fn for each entry until it returns false.
+	Range(fn func(key K, value V) bool) error
+	// CompareAndSwap replaces the value of key only if it currently equals old.
+	CompareAndSwap(key K, old V, new V) (bool, error)
+}
+
+// TransactionStorage stores the transactions matched for each address.
+type TransactionStorage interface {
+	Storage[string, []entities.Transaction]
+	// Append adds transactions after those already stored for key, creating it if needed.
+	Append(key string, transactions []entities.Transaction) error
 }
 
 type Parser interface {
 	GetCurrentBlock() int
 	Subscribe(address string) bool
+	SubscribeConsumer(address string, consumer string) (bool, error)
+	SubscribeFromBlock(address string, consumer string, fromBlock int64) (bool, error)
+	Unsubscribe(address string) bool
+	UnsubscribeConsumer(address string, consumer string) bool
+	SubscribeAll(changes []entities.SubscriptionChange) []entities.SubscriptionChangeResult
+	UnsubscribeAll(changes []entities.SubscriptionChange) []entities.SubscriptionChangeResult
+	GetSubscriptions() ([]entities.Subscription, error)
+	GetSubscription(address string) (*entities.Subscription, error)
 	GetTransactions(address string) ([]entities.Transaction, error)
+	GetTransactionsWithFinality(address string, finality entities.Finality) ([]entities.Transaction, error)
+	GetTransactionsAfter(address string, consumer string, cursor uint64, finality entities.Finality) ([]entities.Transaction, error)
+	AcknowledgeTransactions(address string, consumer string, sequence uint64) error
+	WatchTransactions(address string) (<-chan struct{}, func())
+	WatchAddresses() TransactionWatch
 	GetTransactionsFromBlock(blockNumber int64, address string) ([]entities.Transaction, error)
+	GetBlockByNumber(blockNumber int64) (*entities.Block, error)
+	GetBlocksByNumber(blockNumbers []int64, priority entities.Priority) ([]*entities.Block, error)
+	GetBlockNumberByTag(tag string) (int64, error)
+	GetBlockNumberByTimestamp(timestamp int64) (int64, error)
+	GetBlockTimestamp(blockNumber int64) (int64, error)
+	GetReceipts(transactions []entities.Transaction, priority entities.Priority) (map[string]entities.Receipt, error)
+	GetLogs(fromBlock int64, toBlock int64, topics [][]string, priority entities.Priority) ([]entities.Log, error)
+	GetInternalTransfers(block *entities.Block, priority entities.Priority) (map[string][]entities.InternalTransfer, error)
+	GetPendingTransactions(address string) ([]entities.PendingTransaction, error)
+	SetWebhook(address string, consumer string, url string, secret string) error
+	RemoveWebhook(address string, consumer string) (bool, error)
+	GetWebhooks(address string) ([]entities.Webhook, error)
+	GetDeadLetters() ([]entities.DeadLetter, error)
+	ReplayDeadLetter(id string) error
+	RegisterDevice(address string, device entities.Device) error
+	UnregisterDevice(address string, token string) (bool, error)
+	GetDevices(address string) ([]entities.Device, error)
 	MakeRPCRequest(data string) (*http.Response, error)
+	MakeRPCRequestWithPriority(data string, priority entities.Priority) (*http.Response, error)
+	MakeRPCRequestWithCalls(data string, calls int, priority entities.Priority) (*http.Response, error)
+	MakeBatchRPCRequest(calls []entities.RPCCall, priority entities.Priority) ([]entities.RPCResult, error)
+	GetProviderHealth() []entities.ProviderHealth
+	GetEventStats() entities.EventStats
 	StartBlockWatcher()
-	CleanUpTransactions(address string)
+	StartBackfillWorker()
+	StartMempoolWatcher()
+	StartWebhookDispatcher()
+}
+
+// TransactionWatch follows many addresses through a single signal, for readers fanning out their
+// transactions from one loop.
+type TransactionWatch interface {
+	// Add follows address, which is reported ready at once so its stored transactions are read.
+	Add(address string)
+	Remove(address string)
+	// Signal is signalled, coalesced, when some followed addresses may have transactions ready.
+	Signal() <-chan struct{}
+	// Ready returns the addresses signalled since the previous call.
+	Ready() []string
+	// Stop stops following every address, it must be called once the watch is no longer read.
+	Stop()
 }
 
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// NotificationTransport sends notifications to the push service of a platform.
+type NotificationTransport interface {
+	// Send delivers notifications, all of the same platform, and returns the result of each token.
+	Send(platform string, notifications []entities.Notification) ([]entities.NotificationResult, error)
+	// Supports reports whether notifications of platform can be delivered.
+	Supports(platform string) bool
+}
+
+// HeadSource reports new chain heads to the block watcher.
+type HeadSource interface {
+	// WatchHeads pushes head block numbers into heads until stop is closed or the source fails.
+	WatchHeads(heads chan<- int64, stop <-chan struct{}) error
+}
@@ -1,26 +1,162 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/routes"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
 )
 
 func main() {
-	client := &http.Client{}
-	storage := storages.NewMemoryStorage(storages.NewSubscriptionStorage(), storages.NewTransactionStorage())
-	rpc := services.NewEthereumRPC("https://cloudflare-eth.com", client, storage)
+	finalityFlag := flag.String("finality", entities.FinalityLatest, "Default finality of /transactions: a confirmation count or one of latest, safe, finalized")
+	providers := flag.String("rpc", "https://cloudflare-eth.com", "Comma-separated list of JSON-RPC endpoints, used with failover")
+	rateLimit := flag.String("rate-limit", "", "Request budget of every provider as <rps>:<burst>[:<daily quota>]")
+	providerRateLimits := make(map[string]services.RateLimit)
+	flag.Func("provider-rate-limit", "Request budget of one provider as <url>=<rps>:<burst>[:<daily quota>], can be repeated", func(value string) error {
+		separator := strings.LastIndex(value, "=")
+		if separator < 0 {
+			return fmt.Errorf("expected <url>=<rps>:<burst>[:<daily quota>]")
+		}
+		limit, err := services.ParseRateLimit(value[separator+1:])
+		if err != nil {
+			return err
+		}
+		providerRateLimits[value[:separator]] = limit
+		return nil
+	})
+	providerTracers := make(map[string]string)
+	flag.Func("provider-tracer", "Tracing API of one provider as <url>=callTracer|trace_block, used to find internal transfers, can be repeated", func(value string) error {
+		separator := strings.LastIndex(value, "=")
+		if separator < 0 {
+			return fmt.Errorf("expected <url>=callTracer|trace_block")
+		}
+		tracer, err := services.ParseTracer(value[separator+1:])
+		if err != nil {
+			return err
+		}
+		providerTracers[value[:separator]] = tracer
+		return nil
+	})
+	storageKind := flag.String("storage", "memory", "Storage backend: memory, or disk to keep subscriptions and transactions across restarts")
+	dataDir := flag.String("data-dir", "data", "Directory of the disk storage")
+	webSocketURL := flag.String("ws", "", "Optional WebSocket endpoint used to follow new heads through eth_subscribe")
+	fcmURL := flag.String("fcm-url", "", "Push gateway notifying the registered Android devices, in the FCM multicast format")
+	apnsURL := flag.String("apns-url", "", "Push gateway notifying the registered iOS devices, with APNs payloads")
+	pushAPIKey := flag.String("push-api-key", "", "Bearer token sent to the push gateways")
+	maxSubscriptions := flag.Int("max-subscriptions", 100000, "Maximum number of subscribed addresses, from the HTTP and WebSocket APIs alike, 0 for unlimited")
+	mempool := flag.Bool("mempool", false, "Report pending transactions, announced through the -ws endpoint or polled with txpool_content")
+	flag.Parse()
+
+	finality, err := entities.ParseFinality(*finalityFlag)
+	if err != nil {
+		fmt.Println("Error parsing finality:", err)
+		return
+	}
+
+	urls := strings.Split(*providers, ",")
+	if *rateLimit != "" {
+		limit, err := services.ParseRateLimit(*rateLimit)
+		if err != nil {
+			fmt.Println("Error parsing rate limit:", err)
+			return
+		}
+		for _, url := range urls {
+			if _, exists := providerRateLimits[url]; !exists {
+				providerRateLimits[url] = limit
+			}
+		}
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	storage, err := newStorage(*storageKind, *dataDir)
+	if err != nil {
+		fmt.Println("Error opening storage:", err)
+		return
+	}
+	opts := []services.Option{services.WithFinality(finality), services.WithRateLimits(providerRateLimits), services.WithTracers(providerTracers), services.WithMaxSubscriptions(*maxSubscriptions)}
+	if *webSocketURL != "" {
+		opts = append(opts, services.WithHeadSource(services.NewWebSocketHeadSource(*webSocketURL)))
+	}
+	if *mempool {
+		opts = append(opts, services.WithMempool())
+	}
+	if *fcmURL != "" || *apnsURL != "" {
+		gateways := make(map[string]string)
+		if *fcmURL != "" {
+			gateways[entities.PlatformAndroid] = *fcmURL
+		}
+		if *apnsURL != "" {
+			gateways[entities.PlatformIOS] = *apnsURL
+		}
+		transport := &services.HTTPNotificationTransport{URLs: gateways, APIKey: *pushAPIKey, Client: client}
+		opts = append(opts, services.WithNotificationTransport(transport))
+	}
+	rpc := services.NewEthereumRPC(urls, client, storage, opts...)
 
 	router := http.NewServeMux()
 	routes.RegisterRoutes(router, rpc)
 
 	fmt.Println("Server is running on http://localhost:8080")
-	err := http.ListenAndServe(":8080", router)
+	err = http.ListenAndServe(":8080", router)
 	if err != nil {
 		fmt.Printf("Error starting HTTP server: %v\n", err)
 		return
 	}
 }
+
+func newStorage(kind string, dataDir string) (*storages.MemoryStorage, error) {
+	switch kind {
+	case "memory":
+		return storages.NewMemoryStorage(), nil
+	case "disk":
+		subscriptions, err := storages.NewDiskSubscriptionStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		transactions, err := storages.NewDiskTransactionStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		streams, err := storages.NewDiskStreamStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		backfills, err := storages.NewDiskBackfillStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		pending, err := storages.NewDiskPendingStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		webhooks, err := storages.NewDiskWebhookStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		deadLetters, err := storages.NewDiskDeadLetterStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		devices, err := storages.NewDiskDeviceStorage(dataDir)
+		if err != nil {
+			return nil, err
+		}
+		return &storages.MemoryStorage{
+			Subscriptions: subscriptions,
+			Transactions:  transactions,
+			Streams:       streams,
+			Backfills:     backfills,
+			Pending:       pending,
+			Webhooks:      webhooks,
+			DeadLetters:   deadLetters,
+			Devices:       devices,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown storage %q, expected memory or disk", kind)
+}
@@ -16,7 +16,67 @@ func RegisterRoutes(router *http.ServeMux, rpc interfaces.Parser) {
 		handlers.HandleSubscribe(w, r, rpc)
 	})
 
+	router.HandleFunc("/subscribe/bulk", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleBulkSubscribe(w, r, rpc)
+	})
+
+	router.HandleFunc("/unsubscribe", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleUnsubscribe(w, r, rpc)
+	})
+
+	router.HandleFunc("/unsubscribe/bulk", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleBulkUnsubscribe(w, r, rpc)
+	})
+
+	router.HandleFunc("/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleSubscriptions(w, r, rpc)
+	})
+
+	router.HandleFunc("/subscriptions/", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleSubscriptions(w, r, rpc)
+	})
+
 	router.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
 		handlers.HandleTransactions(w, r, rpc)
 	})
+
+	router.HandleFunc("/transactions/ack", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleAcknowledge(w, r, rpc)
+	})
+
+	router.HandleFunc("/transactions/stream", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleTransactionStream(w, r, rpc)
+	})
+
+	router.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandlePushSocket(w, r, rpc)
+	})
+
+	router.HandleFunc("/transactions/pending", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandlePendingTransactions(w, r, rpc)
+	})
+
+	router.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleWebhooks(w, r, rpc)
+	})
+
+	router.HandleFunc("/webhooks/deadletters", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleDeadLetters(w, r, rpc)
+	})
+
+	router.HandleFunc("/webhooks/deadletters/replay", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleReplayDeadLetter(w, r, rpc)
+	})
+
+	router.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleDevices(w, r, rpc)
+	})
+
+	router.HandleFunc("/providers", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleProviders(w, r, rpc)
+	})
+
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		handlers.HandleMetrics(w, r, rpc)
+	})
 }
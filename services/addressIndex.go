@@ -0,0 +1,96 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// addressIndex maps lower-cased addresses to the subscriptions watching them,
+// so a block can be matched against every subscriber in a single pass.
+type addressIndex struct {
+	subscribers      map[string][]string
+	lastCheckedBlock map[string]int64
+}
+
+func newAddressIndex(subscriptions map[string]int64) *addressIndex {
+	index := &addressIndex{
+		subscribers:      make(map[string][]string),
+		lastCheckedBlock: make(map[string]int64),
+	}
+	for address, lastCheckedBlock := range subscriptions {
+		key := strings.ToLower(address)
+		index.subscribers[key] = append(index.subscribers[key], address)
+		index.lastCheckedBlock[address] = lastCheckedBlock
+	}
+	return index
+}
+
+// lowestCheckedBlock returns the smallest lastCheckedBlock among all subscriptions.
+func (i *addressIndex) lowestCheckedBlock() int64 {
+	lowest := int64(-1)
+	for _, block := range i.lastCheckedBlock {
+		if lowest == -1 || block < lowest {
+			lowest = block
+		}
+	}
+	return lowest
+}
+
+// match groups the transactions of a block, the token transfers of its logs and the internal transfers
+// of its transactions, keyed by lower-cased hash, by the subscriptions they involve. Subscriptions that
+// already checked that block are skipped.
+func (i *addressIndex) match(block entities.Block, logs []entities.Log, internal map[string][]entities.InternalTransfer) map[string][]entities.Transaction {
+	matches := make(map[string][]entities.Transaction)
+	for _, tx := range block.Transactions {
+		i.matchParties(matches, block.Number, tx.From, tx.To, tx)
+	}
+	for _, log := range logs {
+		kind, transfers := decodeTokenTransfers(log)
+		for _, transfer := range transfers {
+			i.matchParties(matches, block.Number, transfer.From, transfer.To, tokenTransaction(block, log, kind, transfer))
+		}
+	}
+	for _, tx := range block.Transactions {
+		for _, transfer := range internal[strings.ToLower(tx.Hash)] {
+			transfer := transfer
+			record := tx
+			record.Kind = entities.TransactionKindInternal
+			record.Internal = &transfer
+			i.matchParties(matches, block.Number, transfer.From, transfer.To, record)
+		}
+	}
+	return matches
+}
+
+// matchParties adds tx to the matches of the subscriptions of from and to, once when they are the same.
+func (i *addressIndex) matchParties(matches map[string][]entities.Transaction, blockNumber int64, from string, to string, tx entities.Transaction) {
+	from = strings.ToLower(from)
+	to = strings.ToLower(to)
+	for _, address := range i.subscribers[from] {
+		if i.lastCheckedBlock[address] < blockNumber {
+			matches[address] = append(matches[address], tx)
+		}
+	}
+	if to == from {
+		return
+	}
+	for _, address := range i.subscribers[to] {
+		if i.lastCheckedBlock[address] < blockNumber {
+			matches[address] = append(matches[address], tx)
+		}
+	}
+}
+
+// advance marks the block as checked for every subscription behind it and
+// returns the subscriptions that moved.
+func (i *addressIndex) advance(blockNumber int64) []string {
+	var advanced []string
+	for address, lastCheckedBlock := range i.lastCheckedBlock {
+		if lastCheckedBlock < blockNumber {
+			i.lastCheckedBlock[address] = blockNumber
+			advanced = append(advanced, address)
+		}
+	}
+	return advanced
+}
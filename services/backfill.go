@@ -0,0 +1,210 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+)
+
+const backfillInterval = 5 * time.Second // Time between backfill rounds once every scan is done or failing
+
+// SubscribeFromBlock subscribes consumer to a new address and scans its history from fromBlock in the
+// background. The address follows the chain tip right away, and its history is stored as it is scanned.
+func (rpc *EthereumRPC) SubscribeFromBlock(address string, consumer string, fromBlock int64) (bool, error) {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+
+	currentBlock := int64(rpc.Methods.GetCurrentBlock())
+	if currentBlock < 0 {
+		return false, errors.New("failed to fetch the current block")
+	}
+	if fromBlock < 0 || fromBlock > currentBlock {
+		return false, fmt.Errorf("%w: got %d, current block is %d", entities.ErrInvalidStartBlock, fromBlock, currentBlock)
+	}
+	_, exists, err := rpc.Storage.Subscriptions.Find(address)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		// The history of a known address was already delivered to its other consumers
+		return false, fmt.Errorf("%w: %s", entities.ErrAlreadySubscribed, address)
+	}
+
+	if _, err := rpc.subscribe(address, consumer, currentBlock); err != nil {
+		return false, err
+	}
+	// The watcher scans the blocks after currentBlock, so the backfill includes it
+	backfill := entities.Backfill{FromBlock: fromBlock, ToBlock: currentBlock, NextBlock: fromBlock}
+	if err := rpc.Storage.Backfills.Save(address, backfill); err != nil {
+		return false, err
+	}
+
+	select {
+	case rpc.backfillWake <- struct{}{}:
+	default:
+	}
+	return true, nil
+}
+
+// StartBackfillWorker scans the history of the addresses subscribed from a past block. Its requests go
+// through the backfill lane, so they never delay the watcher following the chain tip.
+func (rpc *EthereumRPC) StartBackfillWorker() {
+	for {
+		if !rpc.runBackfills() {
+			select {
+			case <-rpc.backfillWake:
+			case <-time.After(backfillInterval):
+			}
+		}
+	}
+}
+
+// runBackfills scans one batch of every pending backfill, taking turns so a long history does not
+// hold back the others. It reports whether any of them progressed.
+func (rpc *EthereumRPC) runBackfills() bool {
+	backfills, err := rpc.Storage.Backfills.GetAll()
+	if err != nil {
+		fmt.Println("Error loading backfills:", err)
+		return false
+	}
+
+	progressed := false
+	for address, backfill := range backfills {
+		if !backfill.Done && rpc.backfillBatch(address, backfill) {
+			progressed = true
+		}
+	}
+	return progressed
+}
+
+// backfillBatch scans the next blocks of backfill and stores the transactions of address found in
+// them. A crash before the progress is saved scans the batch again, storing its transactions twice.
+func (rpc *EthereumRPC) backfillBatch(address string, backfill entities.Backfill) bool {
+	_, subscribed, err := rpc.Storage.Subscriptions.Find(address)
+	if err == nil && !subscribed {
+		err = rpc.Storage.Backfills.Delete(address)
+	}
+	if err != nil || !subscribed {
+		return false
+	}
+
+	lastBlock := backfill.NextBlock + maxBatchSize - 1
+	if lastBlock > backfill.ToBlock {
+		lastBlock = backfill.ToBlock
+	}
+	var blockNumbers []int64
+	for blockNumber := backfill.NextBlock; blockNumber <= lastBlock; blockNumber++ {
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	blocks, fetchErr := rpc.Methods.GetBlocksByNumber(blockNumbers, entities.PriorityBackfill)
+	logs, err := rpc.fetchTransferLogs(blocks, entities.PriorityBackfill)
+	var internal map[int64]map[string][]entities.InternalTransfer
+	if err == nil {
+		internal, err = rpc.fetchInternalTransfers(blocks, entities.PriorityBackfill)
+	}
+	if err != nil {
+		// Scan these blocks again rather than missing their token or internal transfers
+		blocks, fetchErr = nil, err
+	}
+
+	index := newAddressIndex(map[string]int64{address: backfill.NextBlock - 1})
+	var matched []entities.Transaction
+	next := backfill
+	for _, block := range blocks {
+		matched = append(matched, index.match(*block, logs[block.Number], internal[block.Number])[address]...)
+		next.NextBlock = block.Number + 1
+	}
+	if len(matched) > 0 {
+		if err := rpc.attachReceipts(map[string][]entities.Transaction{address: matched}, entities.PriorityBackfill); err != nil {
+			fmt.Printf("Error fetching receipts of backfilled transactions of %s: %v\n", address, err)
+			return false
+		}
+		if err := rpc.Events().Publish(entities.TransactionMatched{Address: address, Transactions: matched, Backfill: true}); err != nil {
+			fmt.Printf("Error storing backfilled transactions of %s: %v\n", address, err)
+			return false
+		}
+	}
+
+	next.Transactions += len(matched)
+	next.Progress = float64(next.NextBlock-next.FromBlock) * 100 / float64(next.ToBlock-next.FromBlock+1)
+	next.Done = next.NextBlock > next.ToBlock
+	next.LastError = ""
+	if fetchErr != nil {
+		fmt.Printf("Error backfilling %s at block %d: %v\n", address, next.NextBlock, fetchErr)
+		next.LastError = fetchErr.Error()
+	}
+
+	// The address may have been unsubscribed and subscribed again in the meantime
+	swapped, err := rpc.Storage.Backfills.CompareAndSwap(address, backfill, next)
+	if err != nil && !errors.Is(err, storages.ErrNotFound) {
+		fmt.Printf("Error saving backfill progress of %s: %v\n", address, err)
+	}
+	return swapped && len(blocks) > 0
+}
+
+// GetBlockNumberByTimestamp returns the first block mined at or after timestamp, in unix seconds.
+func (rpc *EthereumRPC) GetBlockNumberByTimestamp(timestamp int64) (int64, error) {
+	currentBlock := int64(rpc.Methods.GetCurrentBlock())
+	if currentBlock < 0 {
+		return 0, errors.New("failed to fetch the current block")
+	}
+	latest, err := rpc.Methods.GetBlockTimestamp(currentBlock)
+	if err != nil {
+		return 0, err
+	}
+	if timestamp > latest {
+		return 0, fmt.Errorf("%w: no block was mined after %d yet", entities.ErrInvalidStartBlock, timestamp)
+	}
+
+	low, high := int64(0), currentBlock
+	for low < high {
+		middle := low + (high-low)/2
+		blockTimestamp, err := rpc.Methods.GetBlockTimestamp(middle)
+		if err != nil {
+			return 0, err
+		}
+		if blockTimestamp < timestamp {
+			low = middle + 1
+		} else {
+			high = middle
+		}
+	}
+	return low, nil
+}
+
+// GetBlockTimestamp returns when a block was mined, in unix seconds, without fetching its transactions.
+func (rpc *EthereumRPC) GetBlockTimestamp(blockNumber int64) (int64, error) {
+	requestData := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x%x", false],"id":1}`, blockNumber)
+
+	resp, err := rpc.Methods.MakeRPCRequestWithPriority(requestData, entities.PriorityBackfill)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Println("Error body read closer:", err)
+		}
+	}(resp.Body)
+
+	var rpcResult struct {
+		Result *struct {
+			Timestamp string `json:"timestamp"`
+		} `json:"result"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResult); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if rpcResult.Result == nil {
+		return 0, fmt.Errorf("block %d not found", blockNumber)
+	}
+
+	return strconv.ParseInt(rpcResult.Result.Timestamp, 0, 64)
+}
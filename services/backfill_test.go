@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// blockRange returns the empty blocks from first to last along with their numbers.
+func blockRange(first int64, last int64) ([]int64, []*entities.Block) {
+	var numbers []int64
+	var blocks []*entities.Block
+	for number := first; number <= last; number++ {
+		numbers = append(numbers, number)
+		blocks = append(blocks, &entities.Block{Number: number})
+	}
+	return numbers, blocks
+}
+
+func TestSubscribeFromBlock(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+
+	_, err := service.SubscribeFromBlock("0x123", "", 101)
+	assert.ErrorIs(t, err, entities.ErrInvalidStartBlock)
+
+	subscribed, err := service.SubscribeFromBlock("0x123", "", 60)
+	require.NoError(t, err)
+	assert.True(t, subscribed)
+
+	lastCheckedBlock, _, _ := storage.Subscriptions.Find("0x123")
+	assert.Equal(t, int64(100), lastCheckedBlock, "the watcher follows the tip right away")
+	backfill, exists, _ := storage.Backfills.Find("0x123")
+	require.True(t, exists)
+	assert.Equal(t, entities.Backfill{FromBlock: 60, ToBlock: 100, NextBlock: 60}, backfill)
+
+	_, err = service.SubscribeFromBlock("0x123", "analytics", 60)
+	assert.ErrorIs(t, err, entities.ErrAlreadySubscribed)
+}
+
+func TestRunBackfillsScansInBatches(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	_, err := service.SubscribeFromBlock("0x123", "", 60)
+	require.NoError(t, err)
+
+	firstNumbers, firstBlocks := blockRange(60, 79)
+	firstBlocks[5].Transactions = []entities.Transaction{{From: "0x123", To: "0x456", Hash: "h1", BlockNumber: 65}}
+	secondNumbers, secondBlocks := blockRange(80, 99)
+	lastNumbers, lastBlocks := blockRange(90, 100)
+	lastBlocks[10].Transactions = []entities.Transaction{{From: "0x456", To: "0X123", Hash: "h2", BlockNumber: 100}}
+
+	mockClient.On("GetBlocksByNumber", firstNumbers, entities.PriorityBackfill).Return(firstBlocks, nil).Once()
+	// The second batch fails halfway and is resumed from the first missing block
+	mockClient.On("GetBlocksByNumber", secondNumbers, entities.PriorityBackfill).Return(secondBlocks[:10], errors.New("block 90: header not found")).Once()
+	mockClient.On("GetBlocksByNumber", lastNumbers, entities.PriorityBackfill).Return(lastBlocks, nil).Once()
+
+	assert.True(t, service.runBackfills())
+	backfill, _, _ := storage.Backfills.Find("0x123")
+	assert.Equal(t, int64(80), backfill.NextBlock)
+	assert.InDelta(t, 48.78, backfill.Progress, 0.01)
+
+	assert.True(t, service.runBackfills())
+	backfill, _, _ = storage.Backfills.Find("0x123")
+	assert.Equal(t, int64(90), backfill.NextBlock)
+	assert.Contains(t, backfill.LastError, "header not found")
+
+	assert.True(t, service.runBackfills())
+	backfill, _, _ = storage.Backfills.Find("0x123")
+	assert.True(t, backfill.Done)
+	assert.Equal(t, float64(100), backfill.Progress)
+	assert.Equal(t, 2, backfill.Transactions)
+	assert.Empty(t, backfill.LastError)
+
+	assert.False(t, service.runBackfills(), "nothing is left to scan")
+	mockClient.AssertExpectations(t)
+
+	stored, _, _ := storage.Transactions.Find("0x123")
+	assert.Equal(t, []string{"h1", "h2"}, hashes(stored))
+	assert.Equal(t, []uint64{1, 2}, sequences(stored))
+
+	subscription, err := service.GetSubscription("0x123")
+	require.NoError(t, err)
+	require.NotNil(t, subscription.Backfill)
+	assert.True(t, subscription.Backfill.Done)
+}
+
+func TestRunBackfillsDropsUnsubscribedAddresses(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	service, storage := newSubscriptionService(mockClient)
+	storage.Backfills.Save("0x123", entities.Backfill{FromBlock: 60, ToBlock: 100, NextBlock: 60})
+
+	assert.False(t, service.runBackfills())
+	_, exists, _ := storage.Backfills.Find("0x123")
+	assert.False(t, exists)
+	mockClient.AssertNotCalled(t, "GetBlocksByNumber")
+}
+
+func TestBackfillAndWatcherStoreInSequenceOrder(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	_, err := service.SubscribeFromBlock("0x123", "", 1)
+	require.NoError(t, err)
+
+	// Every block has a transaction of the address
+	blocks := func(numbers []int64) []*entities.Block {
+		blocks := make([]*entities.Block, len(numbers))
+		for i, number := range numbers {
+			blocks[i] = &entities.Block{Number: number, Transactions: []entities.Transaction{
+				{From: "0x123", To: "0x456", Hash: fmt.Sprintf("h%d", number), BlockNumber: number},
+			}}
+		}
+		return blocks
+	}
+	mockClient.On("GetBlocksByNumber", mock.Anything, mock.Anything).Return(blocks, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for service.runBackfills() {
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		// Two blocks at a time, so they are fetched in a batch like the backfill
+		for head := int64(102); head <= 200; head += 2 {
+			service.processBlocksUpTo(head)
+		}
+	}()
+	wg.Wait()
+
+	stored, _, _ := storage.Transactions.Find("0x123")
+	require.Len(t, stored, 200)
+	for i := range stored {
+		assert.Equal(t, uint64(i+1), stored[i].Sequence, "transactions are stored in sequence order")
+	}
+}
+
+func TestGetBlockNumberByTimestamp(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service := EthereumRPC{Methods: mockClient}
+	mockClient.On("GetCurrentBlock").Return(100)
+	for number := int64(0); number <= 100; number++ {
+		mockClient.On("GetBlockTimestamp", number).Return(1000+12*number, nil)
+	}
+
+	blockNumber, err := service.GetBlockNumberByTimestamp(1000 + 12*42)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), blockNumber)
+
+	blockNumber, err = service.GetBlockNumberByTimestamp(1000 + 12*42 + 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(43), blockNumber, "the first block mined after the timestamp")
+
+	blockNumber, err = service.GetBlockNumberByTimestamp(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), blockNumber)
+
+	_, err = service.GetBlockNumberByTimestamp(1000 + 12*100 + 1)
+	assert.ErrorIs(t, err, entities.ErrInvalidStartBlock)
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// maxReorgDepth is how many recent blocks are remembered to detect and roll back reorgs.
+const maxReorgDepth = 64
+
+type trackedBlock struct {
+	hash    string
+	matches map[string][]entities.Transaction
+}
+
+// chainTracker remembers the hashes of recently processed blocks and the transactions matched in them.
+type chainTracker struct {
+	blocks map[int64]trackedBlock
+	head   int64
+}
+
+func newChainTracker() *chainTracker {
+	return &chainTracker{
+		blocks: make(map[int64]trackedBlock),
+	}
+}
+
+func (c *chainTracker) add(block entities.Block, matches map[string][]entities.Transaction) {
+	c.blocks[block.Number] = trackedBlock{hash: block.Hash, matches: matches}
+	if block.Number > c.head {
+		c.head = block.Number
+	}
+	for number := range c.blocks {
+		if number <= c.head-maxReorgDepth {
+			delete(c.blocks, number)
+		}
+	}
+}
+
+func (c *chainTracker) hash(blockNumber int64) (string, bool) {
+	block, exists := c.blocks[blockNumber]
+	return block.hash, exists
+}
+
+// removeAfter forgets every block above blockNumber and returns them in ascending order.
+func (c *chainTracker) removeAfter(blockNumber int64) []trackedBlock {
+	var removed []trackedBlock
+	for number := blockNumber + 1; number <= c.head; number++ {
+		if block, exists := c.blocks[number]; exists {
+			removed = append(removed, block)
+			delete(c.blocks, number)
+		}
+	}
+	if c.head > blockNumber {
+		c.head = blockNumber
+	}
+	return removed
+}
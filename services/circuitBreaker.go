@@ -0,0 +1,76 @@
+package services
+
+import (
+	"time"
+)
+
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half-open"
+
+	defaultCircuitThreshold = 3                // Consecutive failures that open the circuit
+	defaultCircuitCooldown  = 30 * time.Second // Time an open circuit waits before a trial request
+)
+
+// circuitBreaker stops sending requests to a failing provider for a while, then lets a single trial
+// request through to decide whether it recovered. It is not safe for concurrent use on its own.
+type circuitBreaker struct {
+	threshold     int64
+	cooldown      time.Duration
+	state         string
+	failures      int64
+	openedAt      time.Time
+	trialInFlight bool
+	now           func() time.Time
+}
+
+func newCircuitBreaker(threshold int64, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     circuitClosed,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a request may be sent, moving an expired open circuit to half-open.
+func (b *circuitBreaker) allow() bool {
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.trialInFlight = true
+		return true
+	case circuitHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	}
+	return true
+}
+
+// release gives up the trial request let through by allow without sending it, so the next request
+// is the trial instead.
+func (b *circuitBreaker) release() {
+	b.trialInFlight = false
+}
+
+func (b *circuitBreaker) success() {
+	b.state = circuitClosed
+	b.failures = 0
+	b.trialInFlight = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+		b.trialInFlight = false
+	}
+}
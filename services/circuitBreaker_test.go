@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerLifecycle(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := newCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	assert.True(t, breaker.allow())
+	breaker.failure()
+	assert.Equal(t, circuitClosed, breaker.state, "a single failure should not open the circuit")
+	breaker.failure()
+	assert.Equal(t, circuitOpen, breaker.state)
+	assert.False(t, breaker.allow(), "an open circuit rejects requests during the cooldown")
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow(), "a trial request is allowed after the cooldown")
+	assert.Equal(t, circuitHalfOpen, breaker.state)
+	assert.False(t, breaker.allow(), "only one trial request is allowed at a time")
+
+	breaker.failure()
+	assert.Equal(t, circuitOpen, breaker.state, "a failed trial reopens the circuit")
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow())
+	breaker.success()
+	assert.Equal(t, circuitClosed, breaker.state)
+	assert.True(t, breaker.allow())
+}
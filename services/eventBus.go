@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// DeliveryMode sets how the events reach a subscriber of an EventBus.
+type DeliveryMode int
+
+const (
+	// DeliverSync runs the handler in the publisher, in subscription order, and fails the publish on
+	// its first error so the publisher can retry. Later subscribers are not reached in that case, and the
+	// earlier ones get the event again on the retry.
+	DeliverSync DeliveryMode = iota
+	// DeliverQueued handles the events in order from a bounded queue, the publisher waits for room when
+	// it is full so no event is lost. Failing handlers are retried with backoff before giving up. Handlers
+	// waiting on external I/O stall the publisher through the queue, they must use DeliverDroppable.
+	DeliverQueued
+	// DeliverDroppable handles the events in order from a bounded queue, dropping them while it is full.
+	// Failing handlers are retried like queued ones. It suits best-effort subscribers, and those able to
+	// catch up on their own, that must never slow the publisher down.
+	DeliverDroppable
+)
+
+func (mode DeliveryMode) String() string {
+	switch mode {
+	case DeliverSync:
+		return "sync"
+	case DeliverQueued:
+		return "queued"
+	case DeliverDroppable:
+		return "droppable"
+	}
+	return fmt.Sprintf("DeliveryMode(%d)", int(mode))
+}
+
+const defaultEventQueueSize = 1024 // Events waiting for a queued subscriber
+
+var eventRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// EventBus delivers the events published by the watcher to its subscribers in-process.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers []*eventSubscriber
+}
+
+type eventSubscriber struct {
+	name    string
+	mode    DeliveryMode
+	types   map[string]bool
+	handler func(event entities.Event) error
+	queue   chan entities.Event
+
+	delivered uint64
+	failed    uint64
+	dropped   uint64
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe delivers the events of the given types, or all of them when none is given, to handler.
+// Queued modes buffer up to queueSize events, defaultEventQueueSize when it is not positive.
+func (b *EventBus) Subscribe(name string, mode DeliveryMode, queueSize int, handler func(event entities.Event) error, types ...string) {
+	subscriber := &eventSubscriber{name: name, mode: mode, handler: handler}
+	if len(types) > 0 {
+		subscriber.types = make(map[string]bool, len(types))
+		for _, eventType := range types {
+			subscriber.types[eventType] = true
+		}
+	}
+	if mode != DeliverSync {
+		if queueSize <= 0 {
+			queueSize = defaultEventQueueSize
+		}
+		subscriber.queue = make(chan entities.Event, queueSize)
+		go subscriber.run()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscriber)
+}
+
+// Publish runs the synchronous subscribers of event, then queues it for the others. It only fails
+// when a synchronous subscriber does, in which case the event is not queued.
+func (b *EventBus) Publish(event entities.Event) error {
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if subscriber.mode != DeliverSync || !subscriber.accepts(event) {
+			continue
+		}
+		if err := subscriber.handler(event); err != nil {
+			atomic.AddUint64(&subscriber.failed, 1)
+			return fmt.Errorf("%s subscriber: %w", subscriber.name, err)
+		}
+		atomic.AddUint64(&subscriber.delivered, 1)
+	}
+
+	for _, subscriber := range subscribers {
+		if subscriber.mode == DeliverSync || !subscriber.accepts(event) {
+			continue
+		}
+		if subscriber.mode == DeliverQueued {
+			subscriber.queue <- event
+			continue
+		}
+		select {
+		case subscriber.queue <- event:
+		default:
+			atomic.AddUint64(&subscriber.dropped, 1)
+		}
+	}
+	return nil
+}
+
+// Stats reports the delivery to every subscriber, in subscription order.
+func (b *EventBus) Stats() []entities.EventSubscriberStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]entities.EventSubscriberStats, len(b.subscribers))
+	for i, subscriber := range b.subscribers {
+		stats[i] = entities.EventSubscriberStats{
+			Name:      subscriber.name,
+			Mode:      subscriber.mode.String(),
+			Queued:    len(subscriber.queue),
+			Delivered: atomic.LoadUint64(&subscriber.delivered),
+			Failed:    atomic.LoadUint64(&subscriber.failed),
+			Dropped:   atomic.LoadUint64(&subscriber.dropped),
+		}
+	}
+	return stats
+}
+
+func (s *eventSubscriber) accepts(event entities.Event) bool {
+	return s.types == nil || s.types[event.EventType()]
+}
+
+// run handles the queued events in order, retrying failing handlers so a transient error does not lose one.
+func (s *eventSubscriber) run() {
+	for event := range s.queue {
+		var err error
+		for attempt := 0; attempt < eventRetryPolicy.MaxAttempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(eventRetryPolicy.backoff(attempt))
+			}
+			if err = s.handler(event); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			fmt.Printf("Error delivering %s event to %s: %v\n", event.EventType(), s.name, err)
+			atomic.AddUint64(&s.failed, 1)
+			continue
+		}
+		atomic.AddUint64(&s.delivered, 1)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func subscriberStats(bus *EventBus, name string) entities.EventSubscriberStats {
+	for _, stats := range bus.Stats() {
+		if stats.Name == name {
+			return stats
+		}
+	}
+	return entities.EventSubscriberStats{}
+}
+
+func TestEventBusDeliveryModes(t *testing.T) {
+	bus := NewEventBus()
+	var mu sync.Mutex
+	var handled []string
+	record := func(name string) func(entities.Event) error {
+		return func(event entities.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, name+":"+event.(entities.TransactionMatched).Address)
+			return nil
+		}
+	}
+
+	failing := errors.New("storage down")
+	bus.Subscribe("storage", DeliverSync, 0, func(event entities.Event) error {
+		if event.(entities.TransactionMatched).Address == "bad" {
+			return failing
+		}
+		return record("storage")(event)
+	}, entities.EventTransactionMatched)
+	bus.Subscribe("queued", DeliverQueued, 1, record("queued"), entities.EventTransactionMatched)
+	bus.Subscribe("blocks", DeliverQueued, 0, func(entities.Event) error {
+		t.Error("blocks subscriber got another type of event")
+		return nil
+	}, entities.EventBlockProcessed)
+
+	assert.ErrorIs(t, bus.Publish(entities.TransactionMatched{Address: "bad"}), failing)
+	for _, address := range []string{"a", "b", "c"} {
+		require.NoError(t, bus.Publish(entities.TransactionMatched{Address: address}))
+	}
+	assert.Eventually(t, func() bool {
+		return subscriberStats(bus, "queued").Delivered == 3
+	}, time.Second, time.Millisecond, "the publisher waits for room in the queue instead of dropping")
+
+	mu.Lock()
+	assert.Equal(t, []string{"storage:a", "storage:b", "storage:c"}, filterPrefix(handled, "storage:"))
+	assert.Equal(t, []string{"queued:a", "queued:b", "queued:c"}, filterPrefix(handled, "queued:"), "a failed publish is not queued")
+	mu.Unlock()
+	assert.Equal(t, entities.EventSubscriberStats{Name: "storage", Mode: "sync", Delivered: 3, Failed: 1}, subscriberStats(bus, "storage"))
+}
+
+func filterPrefix(values []string, prefix string) []string {
+	var filtered []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
+
+func TestEventBusDropsAndRetries(t *testing.T) {
+	bus := NewEventBus()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	bus.Subscribe("metrics", DeliverDroppable, 1, func(entities.Event) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	attempts := 0
+	bus.Subscribe("flaky", DeliverQueued, 0, func(entities.Event) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	}, entities.EventSubscriptionAdded)
+
+	require.NoError(t, bus.Publish(entities.SubscriptionAdded{Address: "a"}))
+	<-started
+	// The first event is being handled, the second waits in the queue and the third is dropped
+	require.NoError(t, bus.Publish(entities.BlockProcessed{}))
+	require.NoError(t, bus.Publish(entities.BlockProcessed{}))
+	assert.Equal(t, uint64(1), subscriberStats(bus, "metrics").Dropped)
+	close(release)
+	<-started
+	assert.Eventually(t, func() bool {
+		return subscriberStats(bus, "metrics").Delivered == 2
+	}, time.Second, time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return subscriberStats(bus, "flaky").Delivered == 1
+	}, 5*time.Second, time.Millisecond, "failing handlers are retried")
+	assert.Equal(t, uint64(0), subscriberStats(bus, "flaky").Failed)
+}
+
+// stalledTransport holds every send until released, like a push gateway falling behind.
+type stalledTransport struct {
+	release chan struct{}
+}
+
+func (t stalledTransport) Send(platform string, notifications []entities.Notification) ([]entities.NotificationResult, error) {
+	<-t.release
+	return nil, nil
+}
+
+func (t stalledTransport) Supports(platform string) bool {
+	return true
+}
+
+func TestEventsQueueNotificationsOfABurst(t *testing.T) {
+	release := make(chan struct{})
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	service := EthereumRPC{
+		Storage:               newTestStorage(subscriptions, nil),
+		NotificationTransport: stalledTransport{release: release},
+	}
+	require.NoError(t, service.RegisterDevice(wallet, entities.Device{Token: "tok", Platform: entities.PlatformAndroid}))
+
+	burst := defaultEventQueueSize + 10
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < burst; i++ {
+			service.Events().Publish(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{{Hash: fmt.Sprintf("0x%x", i), From: sender, To: wallet, BlockNumber: 101}}})
+		}
+	}()
+	select {
+	case <-published:
+		t.Fatal("the burst should wait for room in the queue instead of dropping notifications")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	<-published
+	assert.Eventually(t, func() bool {
+		return subscriberStats(service.Events(), "notifications").Delivered == uint64(burst)
+	}, 5*time.Second, time.Millisecond)
+	assert.Zero(t, subscriberStats(service.Events(), "notifications").Dropped)
+	assert.Equal(t, &entities.NotificationStats{BatchesSent: uint64(burst)}, service.GetEventStats().Notifications)
+}
+
+func TestEventsDeliveryModes(t *testing.T) {
+	service := EthereumRPC{Storage: storages.NewMemoryStorage(), NotificationTransport: stalledTransport{}}
+	modes := make(map[string]string)
+	for _, stats := range service.Events().Stats() {
+		modes[stats.Name] = stats.Mode
+	}
+	assert.Equal(t, map[string]string{
+		"storage":       "sync",
+		"streams":       "droppable",
+		"webhooks":      "droppable",
+		"mempool":       "droppable",
+		"notifications": "queued",
+		"metrics":       "queued",
+	}, modes, "only subscribers catching up on their own may lose events")
+
+	require.NoError(t, service.Events().Publish(entities.SubscriptionAdded{Address: wallet}))
+	assert.Eventually(t, func() bool {
+		return service.GetEventStats().Events[entities.EventSubscriptionAdded] == 1
+	}, time.Second, time.Millisecond)
+}
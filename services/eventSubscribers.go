@@ -0,0 +1,103 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// Events returns the event bus fed by the watcher and the backfills, so new components can subscribe
+// to the same events as the storage, the webhooks and the streams.
+func (rpc *EthereumRPC) Events() *EventBus {
+	rpc.busOnce.Do(func() {
+		bus := NewEventBus()
+		// Storage is the only synchronous subscriber, the watcher advances once it succeeded
+		bus.Subscribe("storage", DeliverSync, 0, rpc.storeEvent, entities.EventTransactionMatched, entities.EventTransactionReverted)
+		// Streams, webhooks and the mempool never hold the watcher back. Streams and webhooks read from the
+		// storage what a dropped signal missed on the next one, and pending transactions are looked up anyway
+		bus.Subscribe("streams", DeliverDroppable, 0, rpc.notifyEvent, entities.EventTransactionMatched, entities.EventTransactionReverted, entities.EventBlockProcessed)
+		bus.Subscribe("webhooks", DeliverDroppable, 0, func(entities.Event) error {
+			rpc.wakeWebhooks()
+			return nil
+		}, entities.EventTransactionMatched, entities.EventTransactionReverted)
+		bus.Subscribe("mempool", DeliverDroppable, 0, func(event entities.Event) error {
+			rpc.settlePending(event.(entities.BlockProcessed).Block, time.Now())
+			return nil
+		}, entities.EventBlockProcessed)
+		if rpc.NotificationTransport != nil {
+			// Nothing sends a lost notification later, a burst waits for room instead
+			bus.Subscribe("notifications", DeliverQueued, 0, rpc.dispatchNotifications, entities.EventTransactionMatched, entities.EventTransactionReverted)
+		}
+		// Counting never waits on anything, so the metrics see every event
+		bus.Subscribe("metrics", DeliverQueued, 0, rpc.metrics.count)
+		rpc.bus = bus
+	})
+	return rpc.bus
+}
+
+// GetEventStats reports the events seen by the metrics subscriber, the delivery to every subscriber and
+// the notification batches sent when notifications are configured. Events still queued are not counted
+// yet, and droppable subscribers report the events they lost as dropped.
+func (rpc *EthereumRPC) GetEventStats() entities.EventStats {
+	stats := entities.EventStats{Events: rpc.metrics.counts(), Subscribers: rpc.Events().Stats()}
+	if rpc.NotificationTransport != nil {
+		stats.Notifications = &entities.NotificationStats{
+			BatchesSent:         atomic.LoadUint64(&rpc.notificationStats.BatchesSent),
+			BatchesFailed:       atomic.LoadUint64(&rpc.notificationStats.BatchesFailed),
+			NotificationsFailed: atomic.LoadUint64(&rpc.notificationStats.NotificationsFailed),
+		}
+	}
+	return stats
+}
+
+// storeEvent stores the matched or reverted transactions of an event.
+func (rpc *EthereumRPC) storeEvent(event entities.Event) error {
+	switch event := event.(type) {
+	case entities.TransactionMatched:
+		return rpc.storeTransactions(event.Address, event.Transactions)
+	case entities.TransactionReverted:
+		return rpc.storeTransactions(event.Address, event.Transactions)
+	}
+	return nil
+}
+
+// notifyEvent signals the readers of the addresses an event may have new transactions for.
+func (rpc *EthereumRPC) notifyEvent(event entities.Event) error {
+	switch event := event.(type) {
+	case entities.TransactionMatched:
+		rpc.notifyWatchers(event.Address)
+	case entities.TransactionReverted:
+		rpc.notifyWatchers(event.Address)
+	case entities.BlockProcessed:
+		rpc.notifyWatchers("")
+	}
+	return nil
+}
+
+// eventMetrics counts the events published by type.
+type eventMetrics struct {
+	mu     sync.Mutex
+	events map[string]uint64
+}
+
+func (m *eventMetrics) count(event entities.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.events == nil {
+		m.events = make(map[string]uint64)
+	}
+	m.events[event.EventType()]++
+	return nil
+}
+
+func (m *eventMetrics) counts() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]uint64, len(m.events))
+	for eventType, count := range m.events {
+		counts[eventType] = count
+	}
+	return counts
+}
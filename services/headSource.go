@@ -0,0 +1,45 @@
+package services
+
+import (
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// PollingHeadSource reports the chain head by calling eth_blockNumber at a fixed interval.
+type PollingHeadSource struct {
+	Parser   interfaces.Parser
+	Interval time.Duration
+}
+
+// Ensures that PollingHeadSource implements HeadSource
+var _ interfaces.HeadSource = (*PollingHeadSource)(nil)
+
+func NewPollingHeadSource(parser interfaces.Parser, interval time.Duration) *PollingHeadSource {
+	return &PollingHeadSource{
+		Parser:   parser,
+		Interval: interval,
+	}
+}
+
+func (s *PollingHeadSource) WatchHeads(heads chan<- int64, stop <-chan struct{}) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			head := s.Parser.GetCurrentBlock()
+			if head < 0 {
+				continue
+			}
+			select {
+			case heads <- int64(head):
+			case <-stop:
+				return nil
+			}
+		}
+	}
+}
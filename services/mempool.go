@@ -0,0 +1,344 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+const (
+	mempoolPollInterval  = 2 * time.Second  // Time between txpool_content polls while no WebSocket subscription announces them
+	pendingCheckInterval = time.Minute      // Time between lookups of the transactions still pending
+	pendingDropAge       = 10 * time.Minute // Age after which a pending transaction unknown to the node is dropped
+	pendingRetention     = time.Hour        // How long settled transactions are still reported
+	pendingBufferSize    = 4096             // Announcements buffered between the WebSocket and the mempool watcher
+	maxPendingBatch      = 100              // Announcements handled, and hashes looked up, at once
+)
+
+// StartMempoolWatcher records the mempool transactions of subscribed addresses, announced by the
+// WebSocket head source or found by polling txpool_content while there is none, and follows them until
+// they settle.
+func (rpc *EthereumRPC) StartMempoolWatcher() {
+	go rpc.pollTxPool()
+
+	checks := time.NewTicker(pendingCheckInterval)
+	defer checks.Stop()
+	for {
+		select {
+		case tx := <-rpc.pending:
+			batch := []entities.Transaction{tx}
+		drain:
+			for len(batch) < maxPendingBatch {
+				select {
+				case tx := <-rpc.pending:
+					batch = append(batch, tx)
+				default:
+					break drain
+				}
+			}
+			rpc.recordPending(batch, time.Now())
+		case now := <-checks.C:
+			rpc.checkPending(now)
+		}
+	}
+}
+
+// pollTxPool feeds the executable transactions of the node's txpool to the mempool watcher, unless the
+// WebSocket head source is connected and announces them itself.
+func (rpc *EthereumRPC) pollTxPool() {
+	ticker := time.NewTicker(mempoolPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !rpc.pollsTxPool() {
+			continue
+		}
+		results, err := rpc.Methods.MakeBatchRPCRequest([]entities.RPCCall{{Method: "txpool_content"}}, entities.PriorityTip)
+		if err == nil && results[0].Error != nil {
+			err = results[0].Error
+		}
+		if err != nil {
+			fmt.Println("Error polling txpool_content:", err)
+			continue
+		}
+
+		// Queued transactions wait for a nonce gap to be filled, only pending ones can be mined
+		var content struct {
+			Pending map[string]map[string]rpcTransaction `json:"pending"`
+		}
+		if err := json.Unmarshal(results[0].Result, &content); err != nil {
+			fmt.Println("Error decoding txpool_content:", err)
+			continue
+		}
+		var transactions []entities.Transaction
+		for _, byNonce := range content.Pending {
+			for _, tx := range byNonce {
+				if transaction, err := tx.decode(&entities.Block{}); err == nil {
+					transactions = append(transactions, transaction)
+				}
+			}
+		}
+		rpc.recordPending(transactions, time.Now())
+	}
+}
+
+// pollsTxPool reports whether the txpool has to be polled, which is the case unless a WebSocket head
+// source is connected. Heads are polled over HTTP while it is not, its announcements stop with them.
+func (rpc *EthereumRPC) pollsTxPool() bool {
+	_, subscribed := rpc.HeadSource.(*WebSocketHeadSource)
+	return !subscribed || atomic.LoadInt32(&rpc.headFallback) == 1
+}
+
+// recordPending stores the transactions of subscribed addresses among transactions, unless they are
+// known already. Transactions announced by hash alone are looked up first.
+func (rpc *EthereumRPC) recordPending(transactions []entities.Transaction, now time.Time) {
+	subscriptions, err := rpc.Storage.Subscriptions.GetAll()
+	if err != nil {
+		fmt.Println("Error loading subscriptions:", err)
+		return
+	}
+	index := newAddressIndex(subscriptions)
+	if len(index.lastCheckedBlock) == 0 {
+		return
+	}
+
+	var hashes []string
+	for _, tx := range transactions {
+		if tx.From == "" {
+			hashes = append(hashes, tx.Hash)
+		}
+	}
+	found, err := rpc.getTransactionsByHash(hashes, entities.PriorityTip)
+	if err != nil {
+		fmt.Println("Error fetching pending transactions:", err)
+	}
+
+	rpc.pendingMu.Lock()
+	defer rpc.pendingMu.Unlock()
+	for _, tx := range transactions {
+		if tx.From == "" {
+			lookup, exists := found[strings.ToLower(tx.Hash)]
+			if !exists || lookup.BlockNumber > 0 {
+				// Unknown to the node, or mined already
+				continue
+			}
+			tx = lookup
+		}
+		if len(index.subscribers[strings.ToLower(tx.From)]) == 0 && len(index.subscribers[strings.ToLower(tx.To)]) == 0 {
+			continue
+		}
+
+		hash := strings.ToLower(tx.Hash)
+		_, exists, err := rpc.Storage.Pending.Find(hash)
+		if err == nil && !exists {
+			err = rpc.Storage.Pending.Save(hash, entities.PendingTransaction{Transaction: tx, State: entities.PendingStatePending, FirstSeen: now.Unix()})
+		}
+		if err != nil {
+			fmt.Printf("Error recording pending transaction %s: %v\n", tx.Hash, err)
+		}
+	}
+}
+
+// settlePending marks the pending transactions mined in block, and those whose nonce was taken by
+// another transaction of the block as replaced by it. Several transactions may be pending for the same
+// nonce when one was sped up or cancelled, all of them are settled.
+func (rpc *EthereumRPC) settlePending(block entities.Block, now time.Time) {
+	if !rpc.mempool {
+		return
+	}
+	rpc.pendingMu.Lock()
+	defer rpc.pendingMu.Unlock()
+
+	all, err := rpc.Storage.Pending.GetAll()
+	if err != nil {
+		fmt.Println("Error loading pending transactions:", err)
+		return
+	}
+	byNonce := make(map[string][]string)
+	for hash, pending := range all {
+		if pending.State == entities.PendingStatePending {
+			key := nonceKey(pending.From, pending.Nonce)
+			byNonce[key] = append(byNonce[key], hash)
+		}
+	}
+	if len(byNonce) == 0 {
+		return
+	}
+
+	for _, tx := range block.Transactions {
+		hashes, exists := byNonce[nonceKey(tx.From, tx.Nonce)]
+		if !exists {
+			continue
+		}
+		delete(byNonce, nonceKey(tx.From, tx.Nonce))
+
+		for _, hash := range hashes {
+			pending := all[hash]
+			pending.SettledAt = now.Unix()
+			if strings.EqualFold(hash, tx.Hash) {
+				pending.State = entities.PendingStateMined
+				pending.Transaction = tx
+			} else {
+				pending.State = entities.PendingStateReplaced
+				pending.ReplacedBy = tx.Hash
+			}
+			if err := rpc.Storage.Pending.Save(hash, pending); err != nil {
+				fmt.Printf("Error settling pending transaction %s: %v\n", hash, err)
+			}
+		}
+	}
+}
+
+func nonceKey(from string, nonce uint64) string {
+	return fmt.Sprintf("%s/%d", strings.ToLower(from), nonce)
+}
+
+// checkPending looks up the transactions pending for a while. Those the node mined without the watcher
+// seeing it yet are marked mined, the others pending for their nonce replaced, and those it no longer
+// knows after pendingDropAge are dropped.
+// Settled transactions are forgotten after pendingRetention.
+func (rpc *EthereumRPC) checkPending(now time.Time) {
+	rpc.pendingMu.Lock()
+	all, err := rpc.Storage.Pending.GetAll()
+	rpc.pendingMu.Unlock()
+	if err != nil {
+		fmt.Println("Error loading pending transactions:", err)
+		return
+	}
+
+	var hashes []string
+	for hash, pending := range all {
+		switch {
+		case pending.State != entities.PendingStatePending:
+			if now.Unix()-pending.SettledAt > int64(pendingRetention/time.Second) {
+				rpc.updatePending(hash, pending, nil)
+			}
+		case now.Unix()-pending.FirstSeen >= int64(pendingCheckInterval/time.Second):
+			hashes = append(hashes, hash)
+		}
+	}
+
+	sort.Strings(hashes)
+	found, err := rpc.getTransactionsByHash(hashes, entities.PriorityBackfill)
+	if err != nil {
+		fmt.Println("Error checking pending transactions:", err)
+		return
+	}
+	// A transaction mined for a nonce replaced the others pending for it
+	mined := make(map[string]string)
+	for hash, lookup := range found {
+		if lookup.BlockNumber > 0 {
+			mined[nonceKey(lookup.From, lookup.Nonce)] = hash
+		}
+	}
+	for _, hash := range hashes {
+		next := all[hash]
+		lookup, exists := found[hash]
+		replacedBy, replaced := mined[nonceKey(next.From, next.Nonce)]
+		switch {
+		case exists && lookup.BlockNumber > 0:
+			next.State = entities.PendingStateMined
+			next.Transaction = lookup
+		case replaced:
+			next.State = entities.PendingStateReplaced
+			next.ReplacedBy = found[replacedBy].Hash
+		case !exists && now.Unix()-next.FirstSeen >= int64(pendingDropAge/time.Second):
+			next.State = entities.PendingStateDropped
+		default:
+			continue
+		}
+		next.SettledAt = now.Unix()
+		rpc.updatePending(hash, all[hash], &next)
+	}
+}
+
+// updatePending replaces the pending transaction stored under hash with next, or deletes it when next
+// is nil, unless the block watcher changed it since it was read.
+func (rpc *EthereumRPC) updatePending(hash string, previous entities.PendingTransaction, next *entities.PendingTransaction) {
+	rpc.pendingMu.Lock()
+	defer rpc.pendingMu.Unlock()
+
+	current, exists, err := rpc.Storage.Pending.Find(hash)
+	if err != nil || !exists || current.State != previous.State {
+		return
+	}
+	if next == nil {
+		err = rpc.Storage.Pending.Delete(hash)
+	} else {
+		err = rpc.Storage.Pending.Save(hash, *next)
+	}
+	if err != nil {
+		fmt.Printf("Error updating pending transaction %s: %v\n", hash, err)
+	}
+}
+
+// getTransactionsByHash looks up hashes in batches, keyed by lower-cased hash. Unknown hashes are left
+// out, and the BlockNumber of pending transactions is 0.
+func (rpc *EthereumRPC) getTransactionsByHash(hashes []string, priority entities.Priority) (map[string]entities.Transaction, error) {
+	found := make(map[string]entities.Transaction)
+	for start := 0; start < len(hashes); start += maxPendingBatch {
+		end := start + maxPendingBatch
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		calls := make([]entities.RPCCall, end-start)
+		for i, hash := range hashes[start:end] {
+			calls[i] = entities.RPCCall{Method: "eth_getTransactionByHash", Params: []interface{}{hash}}
+		}
+		results, err := rpc.Methods.MakeBatchRPCRequest(calls, priority)
+		if err != nil {
+			return found, err
+		}
+
+		for i, result := range results {
+			var tx *struct {
+				rpcTransaction
+				BlockNumber *string `json:"blockNumber"`
+				BlockHash   *string `json:"blockHash"`
+			}
+			if result.Error != nil || json.Unmarshal(result.Result, &tx) != nil || tx == nil {
+				continue
+			}
+			block := &entities.Block{}
+			if tx.BlockNumber != nil && tx.BlockHash != nil {
+				number, err := decodeQuantity("blockNumber", *tx.BlockNumber)
+				if err != nil {
+					continue
+				}
+				block = &entities.Block{Number: int64(number), Hash: *tx.BlockHash}
+			}
+			transaction, err := tx.decode(block)
+			if err != nil {
+				continue
+			}
+			found[strings.ToLower(hashes[start+i])] = transaction
+		}
+	}
+	return found, nil
+}
+
+// GetPendingTransactions returns the mempool transactions sent by or to address, oldest first, along
+// with those that settled recently.
+func (rpc *EthereumRPC) GetPendingTransactions(address string) ([]entities.PendingTransaction, error) {
+	pending := []entities.PendingTransaction{}
+	err := rpc.Storage.Pending.Range(func(hash string, tx entities.PendingTransaction) bool {
+		if strings.EqualFold(tx.From, address) || strings.EqualFold(tx.To, address) {
+			pending = append(pending, tx)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].FirstSeen != pending[j].FirstSeen {
+			return pending[i].FirstSeen < pending[j].FirstSeen
+		}
+		return pending[i].Hash < pending[j].Hash
+	})
+	return pending, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func states(pending []entities.PendingTransaction) map[string]string {
+	result := make(map[string]string)
+	for _, tx := range pending {
+		result[tx.Hash] = tx.State
+	}
+	return result
+}
+
+func TestPendingTransactionLifecycle(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, nil),
+		Methods: mockClient,
+		mempool: true,
+	}
+	start := time.Unix(1700000000, 0)
+
+	// h3 is announced by hash alone and looked up
+	mockClient.On("MakeBatchRPCRequest", []entities.RPCCall{
+		{Method: "eth_getTransactionByHash", Params: []interface{}{"0xh3"}},
+	}, entities.PriorityTip).Return([]entities.RPCResult{
+		{Result: []byte(`{"from":"` + wallet + `","to":"` + sender + `","value":"0x1","hash":"0xh3","nonce":"0x9","blockNumber":null,"blockHash":null}`)},
+	}, nil)
+	service.recordPending([]entities.Transaction{
+		{From: sender, To: wallet, Hash: "0xh1", Nonce: 5},
+		{From: sender, To: router, Hash: "0xh2", Nonce: 6},
+		{Hash: "0xh3"},
+		{From: wallet, To: sender, Hash: "0xh5", Nonce: 10},
+	}, start)
+
+	pending, err := service.GetPendingTransactions(wallet)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"0xh1": "pending", "0xh3": "pending", "0xh5": "pending"}, states(pending), "only transactions of subscribed addresses are recorded")
+
+	// h1 is mined, and h4 takes the nonce of h3 to cancel it
+	service.settlePending(entities.Block{Number: 101, Hash: "a101", Transactions: []entities.Transaction{
+		{From: sender, To: wallet, Hash: "0xh1", Nonce: 5, BlockNumber: 101},
+		{From: wallet, To: wallet, Hash: "0xh4", Nonce: 9, BlockNumber: 101},
+	}}, start.Add(time.Second))
+
+	// h5 is no longer known to the node
+	mockClient.On("MakeBatchRPCRequest", []entities.RPCCall{
+		{Method: "eth_getTransactionByHash", Params: []interface{}{"0xh5"}},
+	}, entities.PriorityBackfill).Return([]entities.RPCResult{{Result: []byte(`null`)}}, nil)
+	service.checkPending(start.Add(pendingCheckInterval))
+	pending, _ = service.GetPendingTransactions(wallet)
+	assert.Equal(t, "pending", states(pending)["0xh5"], "a transaction missing briefly may still be propagating")
+
+	service.checkPending(start.Add(pendingDropAge))
+	pending, _ = service.GetPendingTransactions(wallet)
+	assert.Equal(t, map[string]string{"0xh1": "mined", "0xh3": "replaced", "0xh5": "dropped"}, states(pending))
+	assert.Equal(t, int64(101), pending[0].BlockNumber)
+	assert.Equal(t, "0xh4", pending[1].ReplacedBy)
+
+	service.checkPending(start.Add(pendingDropAge + pendingRetention + time.Second))
+	pending, _ = service.GetPendingTransactions(wallet)
+	assert.Empty(t, pending, "settled transactions are forgotten after a while")
+}
+
+func TestPendingTransactionsSharingANonce(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, nil),
+		Methods: mockClient,
+		mempool: true,
+	}
+	start := time.Unix(1700000000, 0)
+
+	// h1 is sped up by h2, and h3 is cancelled by h4, all four are pending at once
+	service.recordPending([]entities.Transaction{
+		{From: wallet, To: sender, Hash: "0xh1", Nonce: 5},
+		{From: wallet, To: sender, Hash: "0xh2", Nonce: 5},
+		{From: wallet, To: sender, Hash: "0xh3", Nonce: 6},
+		{From: wallet, To: wallet, Hash: "0xh4", Nonce: 6},
+	}, start)
+
+	service.settlePending(entities.Block{Number: 101, Hash: "a101", Transactions: []entities.Transaction{
+		{From: wallet, To: sender, Hash: "0xh2", Nonce: 5, BlockNumber: 101},
+	}}, start.Add(time.Second))
+	pending, err := service.GetPendingTransactions(wallet)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"0xh1": "replaced", "0xh2": "mined", "0xh3": "pending", "0xh4": "pending"}, states(pending))
+	assert.Equal(t, "0xh2", pending[0].ReplacedBy)
+
+	// The watcher missed the block of h4, which the lookup finds mined
+	mockClient.On("MakeBatchRPCRequest", []entities.RPCCall{
+		{Method: "eth_getTransactionByHash", Params: []interface{}{"0xh3"}},
+		{Method: "eth_getTransactionByHash", Params: []interface{}{"0xh4"}},
+	}, entities.PriorityBackfill).Return([]entities.RPCResult{
+		{Result: []byte(`null`)},
+		{Result: []byte(`{"from":"` + wallet + `","to":"` + wallet + `","value":"0x0","hash":"0xh4","nonce":"0x6","blockNumber":"0x66","blockHash":"a102"}`)},
+	}, nil)
+	service.checkPending(start.Add(pendingCheckInterval))
+	pending, _ = service.GetPendingTransactions(wallet)
+	assert.Equal(t, map[string]string{"0xh1": "replaced", "0xh2": "mined", "0xh3": "replaced", "0xh4": "mined"}, states(pending), "a transaction replaced before the drop age is not dropped")
+	assert.Equal(t, "0xh4", pending[2].ReplacedBy)
+}
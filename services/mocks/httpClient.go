@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -15,13 +16,44 @@ func (m *MockHTTPClient) StartBlockWatcher() {
 	m.Called()
 }
 
+func (m *MockHTTPClient) StartBackfillWorker() {
+	m.Called()
+}
+
+func (m *MockHTTPClient) StartMempoolWatcher() {
+	m.Called()
+}
+
+func (m *MockHTTPClient) GetEventStats() entities.EventStats {
+	args := m.Called()
+	return args.Get(0).(entities.EventStats)
+}
+
+func (m *MockHTTPClient) StartWebhookDispatcher() {
+	m.Called()
+}
+
 func (m *MockHTTPClient) GetCurrentBlock() int {
 	args := m.Called()
 	return args.Int(0)
 }
 
-func (m *MockHTTPClient) CleanUpTransactions(address string) {
-	m.Called(address)
+func (m *MockHTTPClient) AcknowledgeTransactions(address string, consumer string, sequence uint64) error {
+	args := m.Called(address, consumer, sequence)
+	return args.Error(0)
+}
+
+func (m *MockHTTPClient) WatchTransactions(address string) (<-chan struct{}, func()) {
+	args := m.Called(address)
+	signal, _ := args.Get(0).(<-chan struct{})
+	stop, _ := args.Get(1).(func())
+	return signal, stop
+}
+
+func (m *MockHTTPClient) WatchAddresses() interfaces.TransactionWatch {
+	args := m.Called()
+	watch, _ := args.Get(0).(interfaces.TransactionWatch)
+	return watch
 }
 
 func (m *MockHTTPClient) Subscribe(address string) bool {
@@ -29,22 +61,197 @@ func (m *MockHTTPClient) Subscribe(address string) bool {
 	return args.Bool(0)
 }
 
+func (m *MockHTTPClient) SubscribeConsumer(address string, consumer string) (bool, error) {
+	args := m.Called(address, consumer)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockHTTPClient) SubscribeFromBlock(address string, consumer string, fromBlock int64) (bool, error) {
+	args := m.Called(address, consumer, fromBlock)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockHTTPClient) Unsubscribe(address string) bool {
+	args := m.Called(address)
+	return args.Bool(0)
+}
+
+func (m *MockHTTPClient) UnsubscribeConsumer(address string, consumer string) bool {
+	args := m.Called(address, consumer)
+	return args.Bool(0)
+}
+
+func (m *MockHTTPClient) SubscribeAll(changes []entities.SubscriptionChange) []entities.SubscriptionChangeResult {
+	args := m.Called(changes)
+	return args.Get(0).([]entities.SubscriptionChangeResult)
+}
+
+func (m *MockHTTPClient) UnsubscribeAll(changes []entities.SubscriptionChange) []entities.SubscriptionChangeResult {
+	args := m.Called(changes)
+	return args.Get(0).([]entities.SubscriptionChangeResult)
+}
+
+func (m *MockHTTPClient) GetSubscriptions() ([]entities.Subscription, error) {
+	args := m.Called()
+	subscriptions, _ := args.Get(0).([]entities.Subscription)
+	return subscriptions, args.Error(1)
+}
+
+func (m *MockHTTPClient) GetSubscription(address string) (*entities.Subscription, error) {
+	args := m.Called(address)
+	subscription, _ := args.Get(0).(*entities.Subscription)
+	return subscription, args.Error(1)
+}
+
 func (m *MockHTTPClient) GetTransactions(address string) ([]entities.Transaction, error) {
 	args := m.Called(address)
 	return args.Get(0).([]entities.Transaction), args.Error(1)
 }
 
+func (m *MockHTTPClient) GetTransactionsWithFinality(address string, finality entities.Finality) ([]entities.Transaction, error) {
+	args := m.Called(address, finality)
+	return args.Get(0).([]entities.Transaction), args.Error(1)
+}
+
+func (m *MockHTTPClient) GetTransactionsAfter(address string, consumer string, cursor uint64, finality entities.Finality) ([]entities.Transaction, error) {
+	args := m.Called(address, consumer, cursor, finality)
+	return args.Get(0).([]entities.Transaction), args.Error(1)
+}
+
 func (m *MockHTTPClient) GetTransactionsFromBlock(blockNumber int64, address string) ([]entities.Transaction, error) {
 	args := m.Called(blockNumber, address)
 	return args.Get(0).([]entities.Transaction), args.Error(1)
 }
 
+func (m *MockHTTPClient) GetBlockByNumber(blockNumber int64) (*entities.Block, error) {
+	args := m.Called(blockNumber)
+	block, _ := args.Get(0).(*entities.Block)
+	return block, args.Error(1)
+}
+
+// GetBlocksByNumber also accepts a function of the block numbers as return value, to answer every call.
+func (m *MockHTTPClient) GetBlocksByNumber(blockNumbers []int64, priority entities.Priority) ([]*entities.Block, error) {
+	args := m.Called(blockNumbers, priority)
+	if blocks, ok := args.Get(0).(func([]int64) []*entities.Block); ok {
+		return blocks(blockNumbers), args.Error(1)
+	}
+	blocks, _ := args.Get(0).([]*entities.Block)
+	return blocks, args.Error(1)
+}
+
+func (m *MockHTTPClient) GetBlockNumberByTag(tag string) (int64, error) {
+	args := m.Called(tag)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockHTTPClient) GetBlockNumberByTimestamp(timestamp int64) (int64, error) {
+	args := m.Called(timestamp)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockHTTPClient) GetBlockTimestamp(blockNumber int64) (int64, error) {
+	args := m.Called(blockNumber)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// GetReceipts also accepts a function of the transactions as return value, to answer every call.
+func (m *MockHTTPClient) GetReceipts(transactions []entities.Transaction, priority entities.Priority) (map[string]entities.Receipt, error) {
+	args := m.Called(transactions, priority)
+	if receipts, ok := args.Get(0).(func([]entities.Transaction) map[string]entities.Receipt); ok {
+		return receipts(transactions), args.Error(1)
+	}
+	receipts, _ := args.Get(0).(map[string]entities.Receipt)
+	return receipts, args.Error(1)
+}
+
 func (m *MockHTTPClient) MakeRPCRequest(data string) (*http.Response, error) {
 	args := m.Called(data)
 	return args.Get(0).(*http.Response), args.Error(1)
 }
 
+func (m *MockHTTPClient) MakeRPCRequestWithPriority(data string, priority entities.Priority) (*http.Response, error) {
+	args := m.Called(data, priority)
+	return args.Get(0).(*http.Response), args.Error(1)
+}
+
+func (m *MockHTTPClient) MakeRPCRequestWithCalls(data string, calls int, priority entities.Priority) (*http.Response, error) {
+	args := m.Called(data, calls, priority)
+	return args.Get(0).(*http.Response), args.Error(1)
+}
+
+func (m *MockHTTPClient) MakeBatchRPCRequest(calls []entities.RPCCall, priority entities.Priority) ([]entities.RPCResult, error) {
+	args := m.Called(calls, priority)
+	results, _ := args.Get(0).([]entities.RPCResult)
+	return results, args.Error(1)
+}
+
+func (m *MockHTTPClient) GetProviderHealth() []entities.ProviderHealth {
+	args := m.Called()
+	return args.Get(0).([]entities.ProviderHealth)
+}
+
 func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	args := m.Called(req)
 	return args.Get(0).(*http.Response), args.Error(1)
 }
+
+func (m *MockHTTPClient) GetLogs(fromBlock int64, toBlock int64, topics [][]string, priority entities.Priority) ([]entities.Log, error) {
+	args := m.Called(fromBlock, toBlock, topics, priority)
+	logs, _ := args.Get(0).([]entities.Log)
+	return logs, args.Error(1)
+}
+
+func (m *MockHTTPClient) GetInternalTransfers(block *entities.Block, priority entities.Priority) (map[string][]entities.InternalTransfer, error) {
+	args := m.Called(block, priority)
+	transfers, _ := args.Get(0).(map[string][]entities.InternalTransfer)
+	return transfers, args.Error(1)
+}
+
+func (m *MockHTTPClient) GetPendingTransactions(address string) ([]entities.PendingTransaction, error) {
+	args := m.Called(address)
+	pending, _ := args.Get(0).([]entities.PendingTransaction)
+	return pending, args.Error(1)
+}
+
+func (m *MockHTTPClient) SetWebhook(address string, consumer string, url string, secret string) error {
+	args := m.Called(address, consumer, url, secret)
+	return args.Error(0)
+}
+
+func (m *MockHTTPClient) RemoveWebhook(address string, consumer string) (bool, error) {
+	args := m.Called(address, consumer)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockHTTPClient) GetWebhooks(address string) ([]entities.Webhook, error) {
+	args := m.Called(address)
+	webhooks, _ := args.Get(0).([]entities.Webhook)
+	return webhooks, args.Error(1)
+}
+
+func (m *MockHTTPClient) GetDeadLetters() ([]entities.DeadLetter, error) {
+	args := m.Called()
+	deadLetters, _ := args.Get(0).([]entities.DeadLetter)
+	return deadLetters, args.Error(1)
+}
+
+func (m *MockHTTPClient) ReplayDeadLetter(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockHTTPClient) RegisterDevice(address string, device entities.Device) error {
+	args := m.Called(address, device)
+	return args.Error(0)
+}
+
+func (m *MockHTTPClient) UnregisterDevice(address string, token string) (bool, error) {
+	args := m.Called(address, token)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockHTTPClient) GetDevices(address string) ([]entities.Device, error) {
+	args := m.Called(address)
+	devices, _ := args.Get(0).([]entities.Device)
+	return devices, args.Error(1)
+}
@@ -6,13 +6,15 @@ type MockSubscriptionStorage struct {
 	mock.Mock
 }
 
-func (m *MockSubscriptionStorage) Save(key string, value interface{}) {
-	m.Called(key, value)
+func (m *MockSubscriptionStorage) Save(key string, value int64) error {
+	args := m.Called(key, value)
+	return args.Error(0)
 }
 
-func (m *MockSubscriptionStorage) Find(key string) (interface{}, bool) {
+func (m *MockSubscriptionStorage) Find(key string) (int64, bool, error) {
 	args := m.Called(key)
-	return args.Get(0), args.Bool(1)
+	value, _ := args.Get(0).(int64)
+	return value, args.Bool(1), args.Error(2)
 }
 
 func (m *MockSubscriptionStorage) Delete(key string) error {
@@ -20,11 +22,23 @@ func (m *MockSubscriptionStorage) Delete(key string) error {
 	return args.Error(0)
 }
 
-func (m *MockSubscriptionStorage) Update(key string, value interface{}) {
-	m.Called(key, value)
+func (m *MockSubscriptionStorage) Update(key string, value int64) error {
+	args := m.Called(key, value)
+	return args.Error(0)
 }
 
-func (m *MockSubscriptionStorage) GetAll() interface{} {
+func (m *MockSubscriptionStorage) GetAll() (map[string]int64, error) {
 	args := m.Called()
-	return args.Get(0)
+	all, _ := args.Get(0).(map[string]int64)
+	return all, args.Error(1)
+}
+
+func (m *MockSubscriptionStorage) Range(fn func(key string, value int64) bool) error {
+	args := m.Called(fn)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionStorage) CompareAndSwap(key string, old int64, new int64) (bool, error) {
+	args := m.Called(key, old, new)
+	return args.Bool(0), args.Error(1)
 }
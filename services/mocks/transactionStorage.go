@@ -1,18 +1,28 @@
 package mocks
 
-import "github.com/stretchr/testify/mock"
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/stretchr/testify/mock"
+)
 
 type MockTransactionStorage struct {
 	mock.Mock
 }
 
-func (m *MockTransactionStorage) Save(key string, value interface{}) {
-	m.Called(key, value)
+func (m *MockTransactionStorage) Save(key string, value []entities.Transaction) error {
+	args := m.Called(key, value)
+	return args.Error(0)
 }
 
-func (m *MockTransactionStorage) Find(key string) (interface{}, bool) {
+func (m *MockTransactionStorage) Append(key string, transactions []entities.Transaction) error {
+	args := m.Called(key, transactions)
+	return args.Error(0)
+}
+
+func (m *MockTransactionStorage) Find(key string) ([]entities.Transaction, bool, error) {
 	args := m.Called(key)
-	return args.Get(0), args.Bool(1)
+	value, _ := args.Get(0).([]entities.Transaction)
+	return value, args.Bool(1), args.Error(2)
 }
 
 func (m *MockTransactionStorage) Delete(key string) error {
@@ -20,11 +30,23 @@ func (m *MockTransactionStorage) Delete(key string) error {
 	return args.Error(0)
 }
 
-func (m *MockTransactionStorage) Update(key string, value interface{}) {
-	m.Called(key, value)
+func (m *MockTransactionStorage) Update(key string, value []entities.Transaction) error {
+	args := m.Called(key, value)
+	return args.Error(0)
 }
 
-func (m *MockTransactionStorage) GetAll() interface{} {
+func (m *MockTransactionStorage) GetAll() (map[string][]entities.Transaction, error) {
 	args := m.Called()
-	return args.Get(0)
+	all, _ := args.Get(0).(map[string][]entities.Transaction)
+	return all, args.Error(1)
+}
+
+func (m *MockTransactionStorage) Range(fn func(key string, value []entities.Transaction) bool) error {
+	args := m.Called(fn)
+	return args.Error(0)
+}
+
+func (m *MockTransactionStorage) CompareAndSwap(key string, old []entities.Transaction, new []entities.Transaction) (bool, error) {
+	args := m.Called(key, old, new)
+	return args.Bool(0), args.Error(1)
 }
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+const notificationBatchSize = 500 // Notifications sent per request, the multicast limit of FCM
+
+// Errors of FCM and APNs meaning the token will never be valid again.
+var invalidTokenErrors = map[string]bool{
+	"UNREGISTERED":        true,
+	"InvalidRegistration": true,
+	"NotRegistered":       true,
+	"BadDeviceToken":      true,
+	"Unregistered":        true,
+}
+
+// notificationTexts holds the title and body of the notifications by language. The body is formatted
+// with the short hash of the transaction.
+var notificationTexts = map[string]map[string][2]string{
+	"en": {
+		"incoming": {"Incoming transaction", "Your wallet received transaction %s"},
+		"outgoing": {"Outgoing transaction", "Your wallet sent transaction %s"},
+		"reverted": {"Transaction reverted", "Transaction %s was dropped by a chain reorganization"},
+	},
+	"es": {
+		"incoming": {"Transacción recibida", "Tu billetera recibió la transacción %s"},
+		"outgoing": {"Transacción enviada", "Tu billetera envió la transacción %s"},
+		"reverted": {"Transacción revertida", "La transacción %s fue descartada por una reorganización de la cadena"},
+	},
+	"pt": {
+		"incoming": {"Transação recebida", "Sua carteira recebeu a transação %s"},
+		"outgoing": {"Transação enviada", "Sua carteira enviou a transação %s"},
+		"reverted": {"Transação revertida", "A transação %s foi descartada por uma reorganização da cadeia"},
+	},
+}
+
+// RegisterDevice notifies device of the transactions of address, replacing its previous registration.
+func (rpc *EthereumRPC) RegisterDevice(address string, device entities.Device) error {
+	if device.Token == "" || (device.Platform != entities.PlatformIOS && device.Platform != entities.PlatformAndroid) {
+		return entities.ErrInvalidDevice
+	}
+	if rpc.NotificationTransport == nil || !rpc.NotificationTransport.Supports(device.Platform) {
+		return fmt.Errorf("%w: %s", entities.ErrPlatformUnavailable, device.Platform)
+	}
+	if _, subscribed, err := rpc.Storage.Subscriptions.Find(address); err != nil || !subscribed {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", entities.ErrSubscriptionNotFound, address)
+	}
+
+	device.RegisteredAt = time.Now().Unix()
+	return rpc.updateDevices(address, func(devices []entities.Device) []entities.Device {
+		devices = withoutToken(devices, device.Token)
+		return append(devices, device)
+	})
+}
+
+// UnregisterDevice stops notifying the device of token about address, or about every address when it is
+// empty. It reports whether the device was registered.
+func (rpc *EthereumRPC) UnregisterDevice(address string, token string) (bool, error) {
+	addresses := []string{address}
+	if address == "" {
+		var err error
+		if addresses, err = rpc.addressesOfToken(token); err != nil {
+			return false, err
+		}
+	}
+
+	removed := false
+	for _, address := range addresses {
+		err := rpc.updateDevices(address, func(devices []entities.Device) []entities.Device {
+			remaining := withoutToken(devices, token)
+			if len(remaining) < len(devices) {
+				removed = true
+			}
+			return remaining
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return removed, nil
+}
+
+// GetDevices lists the devices notified of the transactions of address, oldest first.
+func (rpc *EthereumRPC) GetDevices(address string) ([]entities.Device, error) {
+	devices, _, err := rpc.Storage.Devices.Find(address)
+	if err != nil {
+		return nil, err
+	}
+	return append([]entities.Device{}, devices...), nil
+}
+
+// addressesOfToken returns the addresses the device of token is registered for.
+func (rpc *EthereumRPC) addressesOfToken(token string) ([]string, error) {
+	var addresses []string
+	err := rpc.Storage.Devices.Range(func(address string, devices []entities.Device) bool {
+		for _, device := range devices {
+			if device.Token == token {
+				addresses = append(addresses, address)
+				break
+			}
+		}
+		return true
+	})
+	return addresses, err
+}
+
+// updateDevices replaces the devices of address by the result of fn, retrying when they changed
+// concurrently. Addresses left without devices are removed.
+func (rpc *EthereumRPC) updateDevices(address string, fn func(devices []entities.Device) []entities.Device) error {
+	for {
+		devices, exists, err := rpc.Storage.Devices.Find(address)
+		if err != nil {
+			return err
+		}
+		next := fn(append([]entities.Device(nil), devices...))
+
+		switch {
+		case !exists && len(next) == 0:
+			return nil
+		case !exists:
+			// Registrations are rare, a concurrent one for a new address is simply overwritten
+			return rpc.Storage.Devices.Save(address, next)
+		case len(next) == 0:
+			return rpc.Storage.Devices.Delete(address)
+		}
+		swapped, err := rpc.Storage.Devices.CompareAndSwap(address, devices, next)
+		if err != nil || swapped {
+			return err
+		}
+	}
+}
+
+func withoutToken(devices []entities.Device, token string) []entities.Device {
+	remaining := devices[:0:0]
+	for _, device := range devices {
+		if device.Token != token {
+			remaining = append(remaining, device)
+		}
+	}
+	return remaining
+}
+
+// dispatchNotifications notifies the devices of an address of its new or reverted transactions, in
+// batches per platform, and forgets the devices whose token the push services rejected for good.
+// Backfilled transactions are history and notify nobody.
+// Each batch is retried on its own, and one still failing is counted in the event stats and given up on
+// without failing the event, so the batches already delivered are never sent again.
+func (rpc *EthereumRPC) dispatchNotifications(event entities.Event) error {
+	var address string
+	var transactions []entities.Transaction
+	switch event := event.(type) {
+	case entities.TransactionMatched:
+		if event.Backfill {
+			return nil
+		}
+		address, transactions = event.Address, event.Transactions
+	case entities.TransactionReverted:
+		address, transactions = event.Address, event.Transactions
+	default:
+		return nil
+	}
+
+	devices, err := rpc.GetDevices(address)
+	if err != nil || len(devices) == 0 {
+		return err
+	}
+	byPlatform := make(map[string][]entities.Notification)
+	for _, tx := range transactions {
+		for _, device := range devices {
+			byPlatform[device.Platform] = append(byPlatform[device.Platform], notificationFor(address, tx, device))
+		}
+	}
+
+	platforms := make([]string, 0, len(byPlatform))
+	for platform := range byPlatform {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	for _, platform := range platforms {
+		notifications := byPlatform[platform]
+		for start := 0; start < len(notifications); start += notificationBatchSize {
+			end := start + notificationBatchSize
+			if end > len(notifications) {
+				end = len(notifications)
+			}
+			results, err := rpc.sendNotifications(platform, notifications[start:end])
+			if err != nil {
+				atomic.AddUint64(&rpc.notificationStats.BatchesFailed, 1)
+				atomic.AddUint64(&rpc.notificationStats.NotificationsFailed, uint64(end-start))
+				fmt.Printf("Error sending %d %s notifications of %s: %v\n", end-start, platform, address, err)
+				continue
+			}
+			atomic.AddUint64(&rpc.notificationStats.BatchesSent, 1)
+			for _, result := range results {
+				if !result.Invalid {
+					continue
+				}
+				if _, err := rpc.UnregisterDevice("", result.Token); err != nil {
+					fmt.Printf("Error forgetting device with invalid token %s: %v\n", shortHash(result.Token), err)
+					continue
+				}
+				fmt.Printf("Forgot device with invalid token %s: %s\n", shortHash(result.Token), result.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// sendNotifications sends a batch of notifications, retrying it with backoff when the gateway fails.
+func (rpc *EthereumRPC) sendNotifications(platform string, notifications []entities.Notification) ([]entities.NotificationResult, error) {
+	var err error
+	for attempt := 0; attempt < defaultRetryPolicy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(defaultRetryPolicy.backoff(attempt))
+		}
+		var results []entities.NotificationResult
+		if results, err = rpc.NotificationTransport.Send(platform, notifications); err == nil {
+			return results, nil
+		}
+	}
+	return nil, err
+}
+
+// notificationFor describes tx to device in its language, English when it is not translated.
+func notificationFor(address string, tx entities.Transaction, device entities.Device) entities.Notification {
+	language := strings.ToLower(device.Locale)
+	if separator := strings.IndexAny(language, "-_"); separator >= 0 {
+		language = language[:separator]
+	}
+	texts, ok := notificationTexts[language]
+	if !ok {
+		texts = notificationTexts["en"]
+	}
+
+	direction := "incoming"
+	if strings.EqualFold(tx.From, address) {
+		direction = "outgoing"
+	}
+	text := texts[direction]
+	if tx.Status == entities.TransactionStatusReverted {
+		text = texts["reverted"]
+	}
+
+	data := map[string]string{
+		"address":     address,
+		"hash":        tx.Hash,
+		"kind":        tx.Kind,
+		"direction":   direction,
+		"blockNumber": strconv.FormatInt(tx.BlockNumber, 10),
+	}
+	if tx.Status != "" {
+		data["status"] = tx.Status
+	}
+	return entities.Notification{
+		Token:    device.Token,
+		Platform: device.Platform,
+		Title:    text[0],
+		Body:     fmt.Sprintf(text[1], shortHash(tx.Hash)),
+		Data:     data,
+	}
+}
+
+// shortHash abbreviates hashes and tokens for display.
+func shortHash(hash string) string {
+	if len(hash) <= 12 {
+		return hash
+	}
+	return hash[:8] + "…" + hash[len(hash)-4:]
+}
+
+// HTTPNotificationTransport POSTs the notifications of each platform to a push gateway, in the FCM
+// multicast format for Android and as APNs payloads for iOS. Gateways answer with the result of every
+// token, in order.
+type HTTPNotificationTransport struct {
+	// URLs maps each platform to the endpoint of its gateway.
+	URLs   map[string]string
+	APIKey string
+	Client interfaces.HTTPClient
+}
+
+// fcmMessage and apnsNotification are the payloads of one notification on each platform.
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification map[string]string `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+}
+
+type apnsNotification struct {
+	DeviceToken string `json:"deviceToken"`
+	Payload     struct {
+		APS struct {
+			Alert map[string]string `json:"alert"`
+			Sound string            `json:"sound"`
+		} `json:"aps"`
+		Data map[string]string `json:"data,omitempty"`
+	} `json:"payload"`
+}
+
+func (t *HTTPNotificationTransport) Supports(platform string) bool {
+	return t.URLs[platform] != ""
+}
+
+func (t *HTTPNotificationTransport) Send(platform string, notifications []entities.Notification) ([]entities.NotificationResult, error) {
+	url, ok := t.URLs[platform]
+	if !ok {
+		return nil, fmt.Errorf("no push gateway configured for %s", platform)
+	}
+
+	var body interface{}
+	switch platform {
+	case entities.PlatformAndroid:
+		messages := make([]fcmMessage, len(notifications))
+		for i, n := range notifications {
+			messages[i] = fcmMessage{Token: n.Token, Notification: map[string]string{"title": n.Title, "body": n.Body}, Data: n.Data}
+		}
+		body = map[string]interface{}{"messages": messages}
+	case entities.PlatformIOS:
+		payloads := make([]apnsNotification, len(notifications))
+		for i, n := range notifications {
+			payloads[i].DeviceToken = n.Token
+			payloads[i].Payload.APS.Alert = map[string]string{"title": n.Title, "body": n.Body}
+			payloads[i].Payload.APS.Sound = "default"
+			payloads[i].Payload.Data = n.Data
+		}
+		body = map[string]interface{}{"notifications": payloads}
+	default:
+		return nil, fmt.Errorf("unknown platform %q", platform)
+	}
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	resp, err := t.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Println("Error body read closer:", err)
+		}
+	}(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("push gateway answered %s", resp.Status)
+	}
+
+	var response struct {
+		Results []struct {
+			Token string `json:"token"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode push gateway response: %v", err)
+	}
+	results := make([]entities.NotificationResult, len(response.Results))
+	for i, result := range response.Results {
+		results[i] = entities.NotificationResult{Token: result.Token, Error: result.Error, Invalid: invalidTokenErrors[result.Error]}
+		if results[i].Token == "" && i < len(notifications) {
+			results[i].Token = notifications[i].Token
+		}
+	}
+	return results, nil
+}
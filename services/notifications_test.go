@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchNotificationsBatchesAndPrunesInvalidTokens(t *testing.T) {
+	var mu sync.Mutex
+	var fcmBatches []fcmMessage
+	var fcmSizes []int
+	var apnsBatches []apnsNotification
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+
+		var results []map[string]string
+		switch r.URL.Path {
+		case "/fcm":
+			var body struct {
+				Messages []fcmMessage `json:"messages"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			fcmBatches = append(fcmBatches, body.Messages...)
+			fcmSizes = append(fcmSizes, len(body.Messages))
+			for _, message := range body.Messages {
+				result := map[string]string{"token": message.Token}
+				if message.Token == "tok-dead" {
+					result["error"] = "UNREGISTERED"
+				}
+				results = append(results, result)
+			}
+		case "/apns":
+			var body struct {
+				Notifications []apnsNotification `json:"notifications"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			apnsBatches = append(apnsBatches, body.Notifications...)
+			for range body.Notifications {
+				results = append(results, map[string]string{})
+			}
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"results": results}))
+	}))
+	defer gateway.Close()
+
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	subscriptions.Save(sender, int64(100))
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, nil),
+		NotificationTransport: &HTTPNotificationTransport{
+			URLs:   map[string]string{entities.PlatformAndroid: gateway.URL + "/fcm", entities.PlatformIOS: gateway.URL + "/apns"},
+			APIKey: "key",
+			Client: gateway.Client(),
+		},
+	}
+
+	assert.ErrorIs(t, service.RegisterDevice(wallet, entities.Device{Token: "tok", Platform: "windows"}), entities.ErrInvalidDevice)
+	assert.ErrorIs(t, service.RegisterDevice(router, entities.Device{Token: "tok", Platform: entities.PlatformIOS}), entities.ErrSubscriptionNotFound)
+	require.NoError(t, service.RegisterDevice(wallet, entities.Device{Token: "tok-ios", Platform: entities.PlatformIOS}))
+	require.NoError(t, service.RegisterDevice(wallet, entities.Device{Token: "tok-pt", Platform: entities.PlatformAndroid, Locale: "pt-BR"}))
+	require.NoError(t, service.RegisterDevice(wallet, entities.Device{Token: "tok-dead", Platform: entities.PlatformAndroid}))
+	require.NoError(t, service.RegisterDevice(sender, entities.Device{Token: "tok-dead", Platform: entities.PlatformAndroid}))
+	for i := 0; i < notificationBatchSize-1; i++ {
+		require.NoError(t, service.RegisterDevice(wallet, entities.Device{Token: fmt.Sprintf("tok-%d", i), Platform: entities.PlatformAndroid, Locale: "de"}))
+	}
+
+	require.NoError(t, service.dispatchNotifications(entities.TransactionMatched{Address: wallet, Backfill: true, Transactions: []entities.Transaction{{Hash: "0xold", From: sender, To: wallet}}}))
+	assert.Empty(t, fcmSizes, "backfilled transactions notify nobody")
+
+	tx := entities.Transaction{Hash: "0xabcdef0123456789", From: sender, To: wallet, BlockNumber: 101, Kind: entities.TransactionKindNative}
+	require.NoError(t, service.dispatchNotifications(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{tx}}))
+
+	assert.Equal(t, []int{notificationBatchSize, 1}, fcmSizes, "android notifications are sent in batches")
+	assert.Equal(t, map[string]string{"title": "Transação recebida", "body": "Sua carteira recebeu a transação 0xabcdef…6789"}, fcmBatches[0].Notification)
+	assert.Equal(t, "Incoming transaction", fcmBatches[2].Notification["title"], "untranslated locales get English")
+	assert.Equal(t, map[string]string{"address": wallet, "hash": tx.Hash, "kind": "native", "direction": "incoming", "blockNumber": "101"}, fcmBatches[0].Data)
+	require.Len(t, apnsBatches, 1)
+	assert.Equal(t, "tok-ios", apnsBatches[0].DeviceToken)
+	assert.Equal(t, map[string]string{"title": "Incoming transaction", "body": "Your wallet received transaction 0xabcdef…6789"}, apnsBatches[0].Payload.APS.Alert)
+
+	devices, err := service.GetDevices(wallet)
+	require.NoError(t, err)
+	assert.Len(t, devices, notificationBatchSize+1)
+	for _, device := range devices {
+		assert.NotEqual(t, "tok-dead", device.Token)
+	}
+	devices, err = service.GetDevices(sender)
+	require.NoError(t, err)
+	assert.Empty(t, devices, "invalid tokens are forgotten for every address")
+
+	removed, err := service.UnregisterDevice(wallet, "tok-ios")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.True(t, service.Unsubscribe(wallet))
+	devices, err = service.GetDevices(wallet)
+	require.NoError(t, err)
+	assert.Empty(t, devices, "unsubscribing forgets the devices of the address")
+}
+
+func TestDispatchNotificationsNeverResendsDeliveredBatches(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var body struct {
+			Messages []fcmMessage `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		sizes = append(sizes, len(body.Messages))
+		if len(body.Messages) < notificationBatchSize {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		results := make([]map[string]string, len(body.Messages))
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"results": results}))
+	}))
+	defer gateway.Close()
+
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, nil),
+		NotificationTransport: &HTTPNotificationTransport{
+			URLs:   map[string]string{entities.PlatformAndroid: gateway.URL},
+			Client: gateway.Client(),
+		},
+	}
+
+	assert.ErrorIs(t, service.RegisterDevice(wallet, entities.Device{Token: "tok-ios", Platform: entities.PlatformIOS}), entities.ErrPlatformUnavailable, "iOS devices need -apns-url")
+	for i := 0; i <= notificationBatchSize; i++ {
+		require.NoError(t, service.RegisterDevice(wallet, entities.Device{Token: fmt.Sprintf("tok-%d", i), Platform: entities.PlatformAndroid}))
+	}
+
+	tx := entities.Transaction{Hash: "0xabcdef0123456789", From: sender, To: wallet, BlockNumber: 101}
+	require.NoError(t, service.dispatchNotifications(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{tx}}), "a failed batch does not fail the event")
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []int{notificationBatchSize, 1, 1, 1}, sizes, "only the failed batch is retried")
+	assert.Equal(t, &entities.NotificationStats{BatchesSent: 1, BatchesFailed: 1, NotificationsFailed: 1}, service.GetEventStats().Notifications, "failed batches are counted")
+}
@@ -1,14 +1,14 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
@@ -16,51 +16,391 @@ import (
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
 )
 
+const (
+	pollingInterval         = 1 * time.Second  // Checks for new blocks every 1 second when polling
+	headSourceRetryInterval = 30 * time.Second // Time spent polling before reconnecting the HeadSource
+	maxBatchSize            = 20               // Blocks fetched per batch request while catching up
+)
+
 type EthereumRPC struct {
-	URL     string
-	Storage *storages.MemoryStorage
-	mu      sync.Mutex
-	Client  interfaces.HTTPClient
-	Methods interfaces.Parser
+	Providers *ProviderPool
+	Storage   *storages.MemoryStorage
+	mu        sync.Mutex
+	streamMu  sync.Mutex
+	// appendLocks serialize the stores of the addresses hashed to them, see appendLock.
+	appendLocks [64]sync.Mutex
+	Methods     interfaces.Parser
+	Finality    entities.Finality
+	// MaxSubscriptions bounds the number of subscribed addresses, new ones are refused beyond it. Zero
+	// means unlimited.
+	MaxSubscriptions int
+	// HeadSource is the preferred source of new heads, HTTP polling is used when it is nil or disconnected.
+	HeadSource      interfaces.HeadSource
+	headSourceRetry time.Duration
+	// headFallback is set while heads are polled because the HeadSource disconnected.
+	headFallback int32
+	chain        *chainTracker
+	// head is the last head seen by the watcher, read atomically.
+	head         int64
+	tagMu        sync.Mutex
+	tagBlocks    map[string]taggedBlock
+	backfillWake chan struct{}
+	// blockReceiptsUnsupported is set once a provider rejected eth_getBlockReceipts.
+	blockReceiptsUnsupported int32
+	mempool                  bool
+	pending                  chan entities.Transaction
+	pendingMu                sync.Mutex
+	// WebhookClient POSTs the webhook payloads, it defaults to a client refusing internal addresses.
+	WebhookClient interfaces.HTTPClient
+	// privateWebhooks lets webhooks target internal hosts, for tests delivering to local servers.
+	privateWebhooks bool
+	webhookWake     chan struct{}
+	webhookMu       sync.Mutex
+	delivering      map[string]bool
+	watchersMu      sync.Mutex
+	watchers        map[string]map[*transactionWatch]bool
+	// NotificationTransport sends the notifications of the registered devices, none are sent when it is nil.
+	NotificationTransport interfaces.NotificationTransport
+	notificationStats     entities.NotificationStats
+	bus                   *EventBus
+	busOnce               sync.Once
+	metrics               eventMetrics
+}
+
+// taggedBlock is the block of a finality tag when the chain was at head.
+type taggedBlock struct {
+	head  int64
+	block int64
 }
 
-func NewEthereumRPC(url string, client interfaces.HTTPClient, storage *storages.MemoryStorage) interfaces.Parser {
+func NewEthereumRPC(urls []string, client interfaces.HTTPClient, storage *storages.MemoryStorage, opts ...Option) interfaces.Parser {
 	rpc := &EthereumRPC{
-		URL:     url,
-		Storage: storage,
-		Client:  client,
+		Providers:    NewProviderPool(urls, client),
+		Storage:      storage,
+		chain:        newChainTracker(),
+		backfillWake: make(chan struct{}, 1),
+		// The webhook client is only the default, options may replace it
+		WebhookClient: newWebhookClient(),
+		webhookWake:   make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(rpc)
+	}
+	if rpc.mempool {
+		rpc.pending = make(chan entities.Transaction, pendingBufferSize)
+		if source, ok := rpc.HeadSource.(*WebSocketHeadSource); ok {
+			source.PendingTransactions = rpc.pending
+		}
 	}
 
 	var _ interfaces.Parser = rpc
 
 	rpc.Methods = rpc
+	rpc.Events()
+	go rpc.Providers.StartHealthChecks(defaultHealthCheckInterval)
 	go rpc.StartBlockWatcher()
+	go rpc.StartBackfillWorker()
+	go rpc.StartWebhookDispatcher()
+	if rpc.mempool {
+		go rpc.StartMempoolWatcher()
+	}
 
 	return rpc
 }
 
 func (rpc *EthereumRPC) StartBlockWatcher() {
-	ticker := time.NewTicker(1 * time.Second) // Checks for new blocks every 1 second
+	heads := make(chan int64, 1)
+	go rpc.watchHeads(heads, nil)
+
+	for head := range heads {
+		rpc.processBlocksUpTo(head)
+	}
+}
+
+// watchHeads feeds heads from the configured HeadSource, falling back to HTTP polling for a while
+// each time it disconnects.
+func (rpc *EthereumRPC) watchHeads(heads chan<- int64, stop <-chan struct{}) {
+	polling := NewPollingHeadSource(rpc.Methods, pollingInterval)
+	if rpc.HeadSource == nil {
+		polling.WatchHeads(heads, stop)
+		return
+	}
+
+	retry := rpc.headSourceRetry
+	if retry == 0 {
+		retry = headSourceRetryInterval
+	}
+
 	for {
+		err := rpc.HeadSource.WatchHeads(heads, stop)
 		select {
-		case <-ticker.C:
-			currentBlock := rpc.Methods.GetCurrentBlock()
-			for address, lastCheckedBlock := range rpc.Storage.Subscriptions.GetAll().(map[string]int64) {
-				for block := lastCheckedBlock + 1; block <= int64(currentBlock); block++ {
-					transactions, err := rpc.GetTransactionsFromBlock(block, address)
-					if err != nil {
-						fmt.Printf("Error fetching transactions for block %d and address %s: %v", block, address, err)
-						continue
-					}
-
-					if transactions != nil {
-						// Updates transactions and signatures using storage-specific methods
-						rpc.Storage.Transactions.Save(address, transactions)
-						rpc.Storage.Subscriptions.Update(address, block)
-					}
+		case <-stop:
+			return
+		default:
+		}
+		fmt.Printf("Head source disconnected, falling back to HTTP polling: %v\n", err)
+		atomic.StoreInt32(&rpc.headFallback, 1)
+
+		fallbackStop := make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+			case <-time.After(retry):
+			}
+			close(fallbackStop)
+		}()
+		polling.WatchHeads(heads, fallbackStop)
+		atomic.StoreInt32(&rpc.headFallback, 0)
+	}
+}
 
+// processBlocksUpTo fetches every block between the oldest lastCheckedBlock and currentBlock once,
+// and matches its transactions against all subscribed addresses at the same time.
+func (rpc *EthereumRPC) processBlocksUpTo(currentBlock int64) {
+	if rpc.chain == nil {
+		rpc.chain = newChainTracker()
+	}
+	atomic.StoreInt64(&rpc.head, currentBlock)
+
+	subscriptions, err := rpc.Storage.Subscriptions.GetAll()
+	if err != nil {
+		fmt.Println("Error loading subscriptions:", err)
+		return
+	}
+	index := newAddressIndex(subscriptions)
+	if len(index.lastCheckedBlock) == 0 {
+		return
+	}
+
+	blockNumber := index.lowestCheckedBlock() + 1
+	for blockNumber <= currentBlock {
+		lastBlock := blockNumber + maxBatchSize - 1
+		if lastBlock > currentBlock {
+			lastBlock = currentBlock
+		}
+		// Ranges that do not reach currentBlock are historical and go through the backfill lane
+		priority := entities.PriorityTip
+		if lastBlock < currentBlock {
+			priority = entities.PriorityBackfill
+		}
+		blocks, fetchErr := rpc.fetchBlocks(blockNumber, lastBlock, priority)
+		logs, err := rpc.fetchTransferLogs(blocks, priority)
+		if err != nil {
+			fmt.Printf("Error fetching token transfers of block %d: %v\n", blockNumber, err)
+			return
+		}
+		internal, err := rpc.fetchInternalTransfers(blocks, priority)
+		if err != nil {
+			fmt.Printf("Error tracing internal transfers: %v\n", err)
+			return
+		}
+
+		reorganized := false
+		for _, block := range blocks {
+			if parentHash, tracked := rpc.chain.hash(block.Number - 1); tracked && parentHash != block.ParentHash {
+				forkPoint, err := rpc.findForkPoint(block.Number - 1)
+				if err != nil {
+					fmt.Printf("Error resolving reorg at block %d: %v\n", block.Number, err)
+					return
+				}
+				if forkPoint == block.Number-1 {
+					// The node answered inconsistently while its head moved, try again on the next tick
+					return
+				}
+				fmt.Printf("Chain reorganization detected, rolling back to block %d\n", forkPoint)
+				if err := rpc.rollbackTo(forkPoint); err != nil {
+					fmt.Printf("Error rolling back to block %d: %v\n", forkPoint, err)
+					return
 				}
+
+				// Re-scan the new canonical blocks from the fork point
+				subscriptions, err := rpc.Storage.Subscriptions.GetAll()
+				if err != nil {
+					fmt.Println("Error loading subscriptions:", err)
+					return
+				}
+				index = newAddressIndex(subscriptions)
+				blockNumber = forkPoint + 1
+				reorganized = true
+				break
+			}
+
+			matches := index.match(*block, logs[block.Number], internal[block.Number])
+			if err := rpc.attachReceipts(matches, priority); err != nil {
+				fmt.Printf("Error fetching receipts of block %d: %v\n", block.Number, err)
+				return
 			}
+			for address, transactions := range matches {
+				if err := rpc.Events().Publish(entities.TransactionMatched{Address: address, Transactions: transactions}); err != nil {
+					// Stop before advancing the subscriptions so the block is matched again
+					fmt.Printf("Error storing transactions of block %d for %s: %v\n", block.Number, address, err)
+					return
+				}
+			}
+			for _, address := range index.advance(block.Number) {
+				rpc.updateLastCheckedBlock(address, block.Number)
+			}
+			rpc.chain.add(*block, matches)
+			if err := rpc.Events().Publish(entities.BlockProcessed{Block: *block}); err != nil {
+				fmt.Printf("Error publishing block %d: %v\n", block.Number, err)
+			}
+			blockNumber = block.Number + 1
+		}
+
+		if !reorganized && fetchErr != nil {
+			// Stop here so the block is fetched again on the next tick instead of being skipped
+			fmt.Printf("Error fetching block %d: %v\n", blockNumber, fetchErr)
+			return
+		}
+	}
+}
+
+// fetchBlocks fetches the blocks from first to last, batching the calls when catching up on a range.
+func (rpc *EthereumRPC) fetchBlocks(first int64, last int64, priority entities.Priority) ([]*entities.Block, error) {
+	if first == last {
+		block, err := rpc.Methods.GetBlockByNumber(first)
+		if err != nil {
+			return nil, err
+		}
+		return []*entities.Block{block}, nil
+	}
+
+	var blockNumbers []int64
+	for blockNumber := first; blockNumber <= last; blockNumber++ {
+		blockNumbers = append(blockNumbers, blockNumber)
+	}
+	return rpc.Methods.GetBlocksByNumber(blockNumbers, priority)
+}
+
+// findForkPoint walks back from blockNumber until the canonical chain agrees with the tracked hashes.
+func (rpc *EthereumRPC) findForkPoint(blockNumber int64) (int64, error) {
+	for ; blockNumber >= 0; blockNumber-- {
+		trackedHash, tracked := rpc.chain.hash(blockNumber)
+		if !tracked {
+			// Deeper than the tracked window, there is nothing left to roll back
+			return blockNumber, nil
+		}
+
+		block, err := rpc.Methods.GetBlockByNumber(blockNumber)
+		if err != nil {
+			return 0, err
+		}
+		if block.Hash == trackedHash {
+			return blockNumber, nil
+		}
+	}
+	return 0, nil
+}
+
+// updateLastCheckedBlock ignores subscriptions removed while their blocks were processed.
+func (rpc *EthereumRPC) updateLastCheckedBlock(address string, blockNumber int64) {
+	err := rpc.Storage.Subscriptions.Update(address, blockNumber)
+	if err != nil && !errors.Is(err, storages.ErrNotFound) {
+		fmt.Printf("Error updating last checked block of %s: %v\n", address, err)
+	}
+}
+
+// rollbackTo removes the transactions stored for blocks orphaned above forkPoint and rewinds the
+// subscriptions so those heights are scanned again.
+func (rpc *EthereumRPC) rollbackTo(forkPoint int64) error {
+	for _, block := range rpc.chain.removeAfter(forkPoint) {
+		for address, transactions := range block.matches {
+			if err := rpc.revertTransactions(address, transactions); err != nil {
+				return err
+			}
+		}
+	}
+
+	return rpc.Storage.Subscriptions.Range(func(address string, lastCheckedBlock int64) bool {
+		if lastCheckedBlock > forkPoint {
+			rpc.updateLastCheckedBlock(address, forkPoint)
+		}
+		return true
+	})
+}
+
+// revertTransactions drops orphaned transactions that no consumer acknowledged yet, and stores a
+// reverted copy of the others so the consumers learn they disappeared.
+func (rpc *EthereumRPC) revertTransactions(address string, orphaned []entities.Transaction) error {
+	orphanedKeys := make(map[string]bool)
+	for _, tx := range orphaned {
+		orphanedKeys[transactionKey(tx)] = true
+	}
+
+	_, acknowledged, err := rpc.acknowledgedRange(address)
+	if err != nil {
+		return err
+	}
+	dropped, err := rpc.removeTransactions(address, func(tx entities.Transaction) bool {
+		return orphanedKeys[transactionKey(tx)] && tx.Status == "" && tx.Sequence > acknowledged
+	})
+	if err != nil {
+		return err
+	}
+
+	// A consumer may have acknowledged some of them while they were being dropped
+	_, acknowledged, err = rpc.acknowledgedRange(address)
+	if err != nil {
+		return err
+	}
+	for _, tx := range dropped {
+		if tx.Sequence > acknowledged {
+			delete(orphanedKeys, transactionKey(tx))
+		}
+	}
+
+	var reverted []entities.Transaction
+	for _, tx := range orphaned {
+		if orphanedKeys[transactionKey(tx)] {
+			tx.Status = entities.TransactionStatusReverted
+			reverted = append(reverted, tx)
+		}
+	}
+	if len(reverted) == 0 {
+		return nil
+	}
+	return rpc.Events().Publish(entities.TransactionReverted{Address: address, Transactions: reverted})
+}
+
+// transactionKey identifies the record of tx, a transaction also carries the token transfers of its logs,
+// an ERC-1155 batch log one transfer per token, and the internal transfers of its calls.
+func transactionKey(tx entities.Transaction) string {
+	if tx.Token != nil {
+		return fmt.Sprintf("%s/%d/%s", tx.Hash, tx.Token.LogIndex, tx.Token.TokenID)
+	}
+	if tx.Internal != nil {
+		return fmt.Sprintf("%s/internal/%d", tx.Hash, tx.Internal.Index)
+	}
+	return tx.Hash
+}
+
+// removeTransactions atomically removes the stored transactions of address matching remove, without
+// losing transactions appended concurrently by the watcher, and returns the removed ones.
+func (rpc *EthereumRPC) removeTransactions(address string, remove func(tx entities.Transaction) bool) ([]entities.Transaction, error) {
+	for {
+		stored, exists, err := rpc.Storage.Transactions.Find(address)
+		if err != nil || !exists {
+			return nil, err
+		}
+
+		var remaining, removed []entities.Transaction
+		for _, tx := range stored {
+			if remove(tx) {
+				removed = append(removed, tx)
+			} else {
+				remaining = append(remaining, tx)
+			}
+		}
+		if len(removed) == 0 {
+			return nil, nil
+		}
+
+		swapped, err := rpc.Storage.Transactions.CompareAndSwap(address, stored, remaining)
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			return removed, nil
 		}
 	}
 }
@@ -116,22 +456,22 @@ func (rpc *EthereumRPC) GetCurrentBlock() int {
 	return int(blockNumber)
 }
 
-func (rpc *EthereumRPC) CleanUpTransactions(address string) {
-	rpc.Storage.Transactions.Delete(address)
+func (rpc *EthereumRPC) Subscribe(address string) bool {
+	added, err := rpc.SubscribeConsumer(address, entities.DefaultConsumer)
+	if err != nil {
+		fmt.Printf("Error subscribing to %s: %v\n", address, err)
+	}
+	return added
 }
 
-func (rpc *EthereumRPC) Subscribe(address string) bool {
+// SubscribeConsumer subscribes consumer to address, it reports whether either of them is new.
+func (rpc *EthereumRPC) SubscribeConsumer(address string, consumer string) (bool, error) {
 	rpc.mu.Lock()
 	defer rpc.mu.Unlock()
-	startBlock := rpc.Methods.GetCurrentBlock()
-	if _, exists := rpc.Storage.Subscriptions.Find(address); !exists {
-		rpc.Storage.Subscriptions.Save(address, int64(startBlock))
-		return true
-	}
-	return false
+	return rpc.subscribe(address, consumer, int64(rpc.Methods.GetCurrentBlock()))
 }
 
-func (rpc *EthereumRPC) GetTransactionsFromBlock(blockNumber int64, address string) ([]entities.Transaction, error) {
+func (rpc *EthereumRPC) GetBlockByNumber(blockNumber int64) (*entities.Block, error) {
 	hexBlockNumber := fmt.Sprintf("0x%x", blockNumber)
 	requestData := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["%s", true],"id":1}`, hexBlockNumber)
 
@@ -147,49 +487,325 @@ func (rpc *EthereumRPC) GetTransactionsFromBlock(blockNumber int64, address stri
 	}(resp.Body)
 
 	var rpcResult struct {
-		Result struct {
-			Transactions []entities.Transaction `json:"transactions"`
-		} `json:"result"`
+		Result json.RawMessage `json:"result"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&rpcResult); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %v", err)
 	}
 
-	// Filter transactions to only include those involving the specified address
-	var filteredTransactions []entities.Transaction
-	for _, tx := range rpcResult.Result.Transactions {
-		if strings.ToLower(tx.From) == strings.ToLower(address) || strings.ToLower(tx.To) == strings.ToLower(address) {
-			filteredTransactions = append(filteredTransactions, tx)
+	return decodeBlock(blockNumber, rpcResult.Result)
+}
+
+// GetBlocksByNumber fetches several blocks in a single batch request. When a call fails, the blocks
+// preceding it are returned together with its error.
+func (rpc *EthereumRPC) GetBlocksByNumber(blockNumbers []int64, priority entities.Priority) ([]*entities.Block, error) {
+	calls := make([]entities.RPCCall, len(blockNumbers))
+	for i, blockNumber := range blockNumbers {
+		calls[i] = entities.RPCCall{
+			Method: "eth_getBlockByNumber",
+			Params: []interface{}{fmt.Sprintf("0x%x", blockNumber), true},
 		}
 	}
 
-	return filteredTransactions, nil
+	results, err := rpc.Methods.MakeBatchRPCRequest(calls, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*entities.Block
+	for i, result := range results {
+		if result.Error != nil {
+			return blocks, fmt.Errorf("block %d: %w", blockNumbers[i], result.Error)
+		}
+		block, err := decodeBlock(blockNumbers[i], result.Result)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// decodeBlock converts an eth_getBlockByNumber result, fetched with full transactions, to a Block.
+func decodeBlock(blockNumber int64, raw json.RawMessage) (*entities.Block, error) {
+	var result *struct {
+		Hash         string           `json:"hash"`
+		ParentHash   string           `json:"parentHash"`
+		Timestamp    string           `json:"timestamp"`
+		Transactions []rpcTransaction `json:"transactions"`
+	}
+
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("failed to decode block %d: %v", blockNumber, err)
+		}
+	}
+	if result == nil {
+		return nil, fmt.Errorf("block %d not found", blockNumber)
+	}
+
+	block := &entities.Block{
+		Number:     blockNumber,
+		Hash:       result.Hash,
+		ParentHash: result.ParentHash,
+	}
+	if result.Timestamp != "" {
+		timestamp, err := strconv.ParseInt(result.Timestamp, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode timestamp of block %d: %v", blockNumber, err)
+		}
+		block.Timestamp = timestamp
+	}
+	for _, tx := range result.Transactions {
+		transaction, err := tx.decode(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode transaction %s of block %d: %v", tx.Hash, blockNumber, err)
+		}
+		block.Transactions = append(block.Transactions, transaction)
+	}
+
+	return block, nil
+}
+
+// GetBlockNumberByTag resolves a block tag such as "safe" or "finalized" to its block number.
+func (rpc *EthereumRPC) GetBlockNumberByTag(tag string) (int64, error) {
+	requestData := fmt.Sprintf(`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["%s", false],"id":1}`, tag)
+
+	resp, err := rpc.Methods.MakeRPCRequest(requestData)
+	if err != nil {
+		return 0, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Println("Error body read closer:", err)
+		}
+	}(resp.Body)
+
+	var rpcResult struct {
+		Result *struct {
+			Number string `json:"number"`
+		} `json:"result"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResult); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if rpcResult.Result == nil {
+		return 0, fmt.Errorf("block tag %s is not supported by the node", tag)
+	}
+
+	return strconv.ParseInt(rpcResult.Result.Number, 0, 64)
+}
+
+func (rpc *EthereumRPC) GetTransactionsFromBlock(blockNumber int64, address string) ([]entities.Transaction, error) {
+	block, err := rpc.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := rpc.fetchTransferLogs([]*entities.Block{block}, entities.PriorityTip)
+	if err != nil {
+		return nil, err
+	}
+	internal, err := rpc.Methods.GetInternalTransfers(block, entities.PriorityTip)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter transactions, token and internal transfers to only include those involving the specified address
+	index := newAddressIndex(map[string]int64{address: blockNumber - 1})
+	return index.match(*block, logs[blockNumber], internal)[address], nil
 }
 
 func (rpc *EthereumRPC) GetTransactions(address string) ([]entities.Transaction, error) {
+	return rpc.GetTransactionsWithFinality(address, rpc.Finality)
+}
+
+func (rpc *EthereumRPC) GetTransactionsWithFinality(address string, finality entities.Finality) ([]entities.Transaction, error) {
+	return rpc.GetTransactionsAfter(address, entities.DefaultConsumer, 0, finality)
+}
+
+// GetTransactionsAfter returns, in sequence order, the stored transactions after cursor, or after those
+// acknowledged by consumer when further, that reached the requested finality along with their current
+// confirmation count. It stops at the first transaction still waiting for confirmations so that
+// acknowledging the last one returned never skips it. Reverted transactions are always final.
+// The zero Finality stands for the service default.
+func (rpc *EthereumRPC) GetTransactionsAfter(address string, consumer string, cursor uint64, finality entities.Finality) ([]entities.Transaction, error) {
+	if finality == (entities.Finality{}) {
+		finality = rpc.Finality
+	}
+
+	// Readers follow every block, so the head comes from the watcher and no lock is held over the network
+	currentBlock := rpc.currentHead()
+	if currentBlock < 0 {
+		return nil, fmt.Errorf("failed to fetch the current block")
+	}
+	maxBlock := currentBlock
+	if finality.Confirmations > 0 {
+		maxBlock = currentBlock - finality.Confirmations + 1
+	}
+	if finality.Tag == entities.FinalitySafe || finality.Tag == entities.FinalityFinalized {
+		tagBlock, err := rpc.tagBlock(finality.Tag, currentBlock)
+		if err != nil {
+			return nil, err
+		}
+		maxBlock = tagBlock
+	}
+
 	rpc.mu.Lock()
 	defer rpc.mu.Unlock()
+	acknowledged, err := rpc.consumerCursor(address, consumer)
+	if err != nil {
+		return nil, err
+	}
+	if acknowledged > cursor {
+		cursor = acknowledged
+	}
+
+	stored, exists, err := rpc.Storage.Transactions.Find(address)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("no transactions found for address %s", address)
+	}
 
-	transactions, exists := rpc.Storage.Transactions.Find(address)
-	if exists {
-		return transactions.([]entities.Transaction), nil
+	var transactions []entities.Transaction
+	for _, tx := range stored {
+		if tx.Sequence <= cursor {
+			continue
+		}
+		if tx.Status == entities.TransactionStatusReverted {
+			transactions = append(transactions, tx)
+			continue
+		}
+		if tx.BlockNumber > maxBlock {
+			break
+		}
+		tx.Confirmations = currentBlock - tx.BlockNumber + 1
+		transactions = append(transactions, tx)
 	}
 
-	return nil, fmt.Errorf("no transactions found for address %s", address)
+	return transactions, nil
+}
+
+// currentHead returns the last head seen by the watcher, asking the providers until it saw one.
+func (rpc *EthereumRPC) currentHead() int64 {
+	if head := atomic.LoadInt64(&rpc.head); head > 0 {
+		return head
+	}
+	return int64(rpc.Methods.GetCurrentBlock())
 }
 
+// tagBlock returns the block of a finality tag, asking the providers at most once per head.
+func (rpc *EthereumRPC) tagBlock(tag string, head int64) (int64, error) {
+	rpc.tagMu.Lock()
+	defer rpc.tagMu.Unlock()
+	if cached, exists := rpc.tagBlocks[tag]; exists && cached.head == head {
+		return cached.block, nil
+	}
+	block, err := rpc.Methods.GetBlockNumberByTag(tag)
+	if err != nil {
+		return 0, err
+	}
+	if rpc.tagBlocks == nil {
+		rpc.tagBlocks = make(map[string]taggedBlock)
+	}
+	rpc.tagBlocks[tag] = taggedBlock{head: head, block: block}
+	return block, nil
+}
+
+// MakeRPCRequest sends data to the healthiest provider in the tip lane, failing over to the others on errors.
 func (rpc *EthereumRPC) MakeRPCRequest(data string) (*http.Response, error) {
-	req, err := http.NewRequest("POST", rpc.URL, bytes.NewBufferString(data))
+	return rpc.MakeRPCRequestWithPriority(data, entities.PriorityTip)
+}
+
+func (rpc *EthereumRPC) MakeRPCRequestWithPriority(data string, priority entities.Priority) (*http.Response, error) {
+	return rpc.Providers.Do(data, priority)
+}
+
+// MakeRPCRequestWithCalls sends data holding a batch of calls, which the rate limits charge one by one.
+func (rpc *EthereumRPC) MakeRPCRequestWithCalls(data string, calls int, priority entities.Priority) (*http.Response, error) {
+	return rpc.Providers.DoBatch(data, calls, priority)
+}
+
+func (rpc *EthereumRPC) GetProviderHealth() []entities.ProviderHealth {
+	return rpc.Providers.Health()
+}
+
+// MakeBatchRPCRequest sends all calls as one JSON-RPC batch and returns their results in call order,
+// correlating the responses by id since nodes may answer a batch in any order.
+func (rpc *EthereumRPC) MakeBatchRPCRequest(calls []entities.RPCCall, priority entities.Priority) ([]entities.RPCResult, error) {
+	type request struct {
+		JSONRPC string        `json:"jsonrpc"`
+		ID      int           `json:"id"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+	}
+
+	requests := make([]request, len(calls))
+	for i, call := range calls {
+		params := call.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		requests[i] = request{JSONRPC: "2.0", ID: i + 1, Method: call.Method, Params: params}
+	}
+
+	data, err := json.Marshal(requests)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := rpc.Client.Do(req)
+	resp, err := rpc.Methods.MakeRPCRequestWithCalls(string(data), len(calls), priority)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Println("Error body read closer:", err)
+		}
+	}(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp, nil
+	type response struct {
+		ID     int                `json:"id"`
+		Result json.RawMessage    `json:"result"`
+		Error  *entities.RPCError `json:"error"`
+	}
+
+	var responses []response
+	if err := json.Unmarshal(body, &responses); err != nil {
+		// Nodes without batch support answer with a single error object
+		var single response
+		if json.Unmarshal(body, &single) == nil && single.Error != nil {
+			return nil, single.Error
+		}
+		return nil, fmt.Errorf("failed to decode batch response: %v", err)
+	}
+
+	results := make([]entities.RPCResult, len(calls))
+	answered := make([]bool, len(calls))
+	for _, r := range responses {
+		if r.ID < 1 || r.ID > len(calls) {
+			continue
+		}
+		results[r.ID-1] = entities.RPCResult{Result: r.Result, Error: r.Error}
+		answered[r.ID-1] = true
+	}
+	for i := range results {
+		if !answered[i] {
+			results[i].Error = &entities.RPCError{Code: -32603, Message: "missing response for batch call " + calls[i].Method}
+		}
+	}
+
+	return results, nil
 }
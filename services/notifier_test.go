@@ -2,11 +2,14 @@ package services
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
 
@@ -14,6 +17,18 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+// newTestStorage keeps every storage in memory, using subscriptions and transactions unless they are nil.
+func newTestStorage(subscriptions interfaces.Storage[string, int64], transactions interfaces.TransactionStorage) *storages.MemoryStorage {
+	storage := storages.NewMemoryStorage()
+	if subscriptions != nil {
+		storage.Subscriptions = subscriptions
+	}
+	if transactions != nil {
+		storage.Transactions = transactions
+	}
+	return storage
+}
+
 func TestGetCurrentBlock(t *testing.T) {
 	mockClient := new(mocks.MockHTTPClient)
 	service := EthereumRPC{Methods: mockClient}
@@ -37,15 +52,13 @@ func TestSubscribe(t *testing.T) {
 	mockTransStorage := new(mocks.MockTransactionStorage)
 
 	// Configuring mock for MemoryStorage
-	mockSubStorage.On("Find", "0x123").Return(nil, false)          // First call returns not found
-	mockSubStorage.On("Save", "0x123", int64(100000)).Return(nil)  // Simulates successful save
-	mockSubStorage.On("Find", "0x123").Return(int64(100000), true) // Second call finds the subscription
+	mockSubStorage.On("Find", "0x123").Return(nil, false, nil)          // First call returns not found
+	mockSubStorage.On("Save", "0x123", int64(100000)).Return(nil)       // Simulates successful save
+	mockSubStorage.On("Find", "0x123").Return(int64(100000), true, nil) // Second call finds the subscription
 
-	mockStorage := storages.NewMemoryStorage(mockSubStorage, mockTransStorage)
+	mockStorage := newTestStorage(mockSubStorage, mockTransStorage)
 
 	service := EthereumRPC{
-		URL:     "http://example.com",
-		Client:  mockClient,
 		Storage: mockStorage,
 		Methods: mockClient,
 	}
@@ -75,6 +88,8 @@ func TestGetTransactionsFromBlock(t *testing.T) {
 		StatusCode: 200,
 		Body:       r,
 	}, nil)
+	mockClient.On("GetLogs", int64(123456), int64(123456), mock.Anything, entities.PriorityTip).Return([]entities.Log{}, nil)
+	mockClient.On("GetInternalTransfers", mock.Anything, entities.PriorityTip).Return(nil, nil)
 
 	transactions, err := service.GetTransactionsFromBlock(123456, "0x123")
 	assert.NoError(t, err)
@@ -83,26 +98,71 @@ func TestGetTransactionsFromBlock(t *testing.T) {
 	assert.Equal(t, "0x123", transactions[1].To)
 }
 
+func TestGetBlockByNumberDecodesTransactionDetails(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service := EthereumRPC{Methods: mockClient}
+
+	mockResponse := `{"jsonrpc":"2.0","id":1,"result":{
+		"hash":"0xb1","parentHash":"0xb0","timestamp":"0x65f1a2b3",
+		"transactions":[
+			{"from":"0x123","to":"0x456","value":"0xde0b6b3a7640000","hash":"0xh1","transactionIndex":"0x0",
+			 "nonce":"0x2a","gas":"0x5208","gasPrice":"0x3b9aca00","maxFeePerGas":"0x77359400",
+			 "maxPriorityFeePerGas":"0x3b9aca00","type":"0x2","chainId":"0x1","input":"0x"},
+			{"from":"0x123","to":null,"value":"0x0","hash":"0xh2","transactionIndex":"0x1",
+			 "nonce":"0x2b","gas":"0x186a0","gasPrice":"0x4a817c800","type":"0x0","input":"0x6080"}
+		]}}`
+	mockClient.On("MakeRPCRequest", mock.Anything).Return(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(mockResponse))),
+	}, nil)
+
+	block, err := service.GetBlockByNumber(100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0x65f1a2b3), block.Timestamp)
+	assert.Len(t, block.Transactions, 2)
+
+	transfer := block.Transactions[0]
+	assert.Equal(t, "0xde0b6b3a7640000", transfer.Value, "the raw value is kept for existing clients")
+	assert.Equal(t, "1000000000000000000", transfer.ValueWei)
+	assert.Equal(t, "0xb1", transfer.BlockHash)
+	assert.Equal(t, int64(100), transfer.BlockNumber)
+	assert.Equal(t, int64(0x65f1a2b3), transfer.Timestamp)
+	assert.Equal(t, uint64(42), transfer.Nonce)
+	assert.Equal(t, uint64(21000), transfer.Gas)
+	assert.Equal(t, "1000000000", transfer.GasPrice)
+	assert.Equal(t, "2000000000", transfer.MaxFeePerGas)
+	assert.Equal(t, "1000000000", transfer.MaxPriorityFeePerGas)
+	assert.Equal(t, uint64(2), transfer.Type)
+	assert.Equal(t, uint64(1), transfer.ChainID)
+	assert.False(t, transfer.ContractCreation)
+
+	deployment := block.Transactions[1]
+	assert.True(t, deployment.ContractCreation)
+	assert.Empty(t, deployment.To)
+	assert.Equal(t, int64(1), deployment.TransactionIndex)
+	assert.Empty(t, deployment.MaxFeePerGas)
+	assert.Equal(t, "0x6080", deployment.Input)
+}
+
 func TestGetTransactions(t *testing.T) {
 	mockClient := new(mocks.MockHTTPClient)
 	mockSubStorage := new(mocks.MockSubscriptionStorage)  // Mock for subscriptions
 	mockTransStorage := new(mocks.MockTransactionStorage) // Mock for transactions
 
-	mockStorage := storages.NewMemoryStorage(mockSubStorage, mockTransStorage)
+	mockStorage := newTestStorage(mockSubStorage, mockTransStorage)
 
 	// Configuring mocks for transaction storage
 	transactions := []entities.Transaction{
-		{From: "0x789", To: "0x123", Value: "111", Hash: "xxx"},
-		{From: "0x123", To: "0x789", Value: "3", Hash: "yyy"},
-		{From: "0x123", To: "0x456", Value: "100", Hash: "zzz"},
+		{From: "0x789", To: "0x123", Value: "111", Hash: "xxx", Sequence: 1},
+		{From: "0x123", To: "0x789", Value: "3", Hash: "yyy", Sequence: 2},
+		{From: "0x123", To: "0x456", Value: "100", Hash: "zzz", Sequence: 3},
 	}
 
-	mockTransStorage.On("Find", "0x123").Return(transactions, true)
-	mockTransStorage.On("Find", "0x999").Return(nil, false)
+	mockTransStorage.On("Find", "0x123").Return(transactions, true, nil)
+	mockTransStorage.On("Find", "0x999").Return(nil, false, nil)
+	mockClient.On("GetCurrentBlock").Return(100)
 
 	service := EthereumRPC{
-		URL:     "http://example.com",
-		Client:  mockClient,
 		Storage: mockStorage,
 		Methods: mockClient,
 	}
@@ -116,3 +176,413 @@ func TestGetTransactions(t *testing.T) {
 	_, err = service.GetTransactions("0x999")
 	assert.Error(t, err, "should return an error for an unsubscribed address")
 }
+
+func TestProcessNewBlocksFetchesEachBlockOnce(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	transactions := storages.NewTransactionStorage()
+	subscriptions.Save("0x123", int64(100))
+	subscriptions.Save("0xABC", int64(101))
+	subscriptions.Save("0x456", int64(102))
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	mockClient.On("GetBlocksByNumber", []int64{101, 102}, entities.PriorityTip).Return([]*entities.Block{
+		{
+			Number: 101,
+			Transactions: []entities.Transaction{
+				{From: "0x123", To: "0xabc", Value: "1", Hash: "h1"},
+			},
+		},
+		{
+			Number: 102,
+			Transactions: []entities.Transaction{
+				{From: "0xabc", To: "0x456", Value: "2", Hash: "h2"},
+				{From: "0x999", To: "0x123", Value: "3", Hash: "h3"},
+			},
+		},
+	}, nil).Once()
+
+	service.processBlocksUpTo(102)
+
+	mockClient.AssertNumberOfCalls(t, "GetBlocksByNumber", 1)
+	mockClient.AssertNotCalled(t, "GetBlockByNumber", mock.Anything)
+
+	stored, _ := transactions.GetAll()
+	assert.Equal(t, []string{"h1", "h3"}, hashes(stored["0x123"]))
+	assert.Equal(t, []uint64{1, 2}, sequences(stored["0x123"]), "each address numbers its own transactions")
+	// 0xABC already checked block 101, so only block 102 is matched for it
+	assert.Equal(t, []string{"h2"}, hashes(stored["0xABC"]))
+	// 0x456 already checked block 102, so nothing is matched for it
+	assert.Empty(t, stored["0x456"])
+
+	all, _ := subscriptions.GetAll()
+	for _, lastCheckedBlock := range all {
+		assert.Equal(t, int64(102), lastCheckedBlock, "every subscription should be caught up to the head")
+	}
+}
+
+func TestProcessNewBlocksRetriesFailedBlock(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save("0x123", int64(100))
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, nil),
+		Methods: mockClient,
+	}
+
+	mockClient.On("GetBlocksByNumber", []int64{101, 102, 103}, entities.PriorityTip).Return([]*entities.Block{
+		{Number: 101, Hash: "a101", ParentHash: "a100"},
+	}, errors.New("block 102: header not found"))
+
+	service.processBlocksUpTo(103)
+
+	lastCheckedBlock, _, _ := subscriptions.Find("0x123")
+	assert.Equal(t, int64(101), lastCheckedBlock, "a failed block must not be skipped")
+}
+
+func hashes(transactions []entities.Transaction) []string {
+	var result []string
+	for _, tx := range transactions {
+		result = append(result, tx.Hash)
+	}
+	return result
+}
+
+func sequences(transactions []entities.Transaction) []uint64 {
+	var result []uint64
+	for _, tx := range transactions {
+		result = append(result, tx.Sequence)
+	}
+	return result
+}
+
+// mockBlockDetails answers every receipt request with a successful execution in the block of each
+// transaction, and finds no token or internal transfers.
+func mockBlockDetails(mockClient *mocks.MockHTTPClient) {
+	mockClient.On("GetReceipts", mock.Anything, mock.Anything).Return(func(transactions []entities.Transaction) map[string]entities.Receipt {
+		receipts := make(map[string]entities.Receipt)
+		for _, tx := range transactions {
+			receipts[strings.ToLower(tx.Hash)] = entities.Receipt{TransactionHash: tx.Hash, BlockHash: tx.BlockHash, Status: entities.ExecutionStatusSuccess}
+		}
+		return receipts
+	}, nil)
+	mockClient.On("GetLogs", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return([]entities.Log{}, nil)
+	mockClient.On("GetInternalTransfers", mock.Anything, mock.Anything).Return(nil, nil)
+}
+
+func mockReorgedChain(mockClient *mocks.MockHTTPClient) {
+	tx1 := entities.Transaction{From: "0x999", To: "0x123", Value: "1", Hash: "h1"}
+	tx2 := entities.Transaction{From: "0x123", To: "0x999", Value: "2", Hash: "h2"}
+
+	// Original chain seen on the first tick
+	mockClient.On("GetBlocksByNumber", []int64{101, 102}, entities.PriorityTip).Return([]*entities.Block{
+		{Number: 101, Hash: "a101", ParentHash: "a100", Transactions: []entities.Transaction{tx1}},
+		{Number: 102, Hash: "a102", ParentHash: "a101", Transactions: []entities.Transaction{tx2}},
+	}, nil).Once()
+
+	// Competing chain replacing blocks 101 and 102, where only tx1 is included again
+	b101 := &entities.Block{Number: 101, Hash: "b101", ParentHash: "a100", Transactions: []entities.Transaction{tx1}}
+	b102 := &entities.Block{Number: 102, Hash: "b102", ParentHash: "b101"}
+	b103 := &entities.Block{Number: 103, Hash: "b103", ParentHash: "b102"}
+	mockClient.On("GetBlockByNumber", int64(103)).Return(b103, nil)
+	mockClient.On("GetBlockByNumber", int64(102)).Return(b102, nil)
+	mockClient.On("GetBlockByNumber", int64(101)).Return(b101, nil)
+	mockClient.On("GetBlocksByNumber", []int64{101, 102, 103}, entities.PriorityTip).Return([]*entities.Block{b101, b102, b103}, nil)
+}
+
+func TestProcessNewBlocksRevertsDeliveredTransactionsOnReorg(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	transactions := storages.NewTransactionStorage()
+	subscriptions.Save("0x123", int64(100))
+	mockReorgedChain(mockClient)
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	service.processBlocksUpTo(102)
+	// The client acknowledges h1 and h2 before the reorg happens
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", entities.DefaultConsumer, 2))
+	service.processBlocksUpTo(103)
+
+	result, _, _ := transactions.Find("0x123")
+	assert.Equal(t, []string{"h1", "h2", "h1"}, hashes(result))
+	assert.Equal(t, []uint64{3, 4, 5}, sequences(result), "sequences of acknowledged transactions are never reused")
+	assert.Equal(t, entities.TransactionStatusReverted, result[0].Status)
+	assert.Equal(t, entities.TransactionStatusReverted, result[1].Status)
+	assert.Empty(t, result[2].Status, "h1 is included again in the canonical chain")
+
+	lastCheckedBlock, _, _ := subscriptions.Find("0x123")
+	assert.Equal(t, int64(103), lastCheckedBlock)
+}
+
+func TestProcessNewBlocksDropsUndeliveredTransactionsOnReorg(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	transactions := storages.NewTransactionStorage()
+	subscriptions.Save("0x123", int64(100))
+	mockReorgedChain(mockClient)
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	service.processBlocksUpTo(102)
+	service.processBlocksUpTo(103)
+
+	stored, _, _ := transactions.Find("0x123")
+	assert.Equal(t, []string{"h1"}, hashes(stored), "orphaned transactions never acknowledged are simply dropped")
+	assert.Equal(t, []uint64{3}, sequences(stored), "sequences of dropped transactions are never reused")
+}
+
+func TestGetTransactionsWithFinality(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	transactions := storages.NewTransactionStorage()
+	transactions.Save("0x123", []entities.Transaction{
+		{From: "0x789", To: "0x123", Hash: "old", BlockNumber: 80, Sequence: 1},
+		{From: "0x123", To: "0x456", Hash: "gone", BlockNumber: 99, Status: entities.TransactionStatusReverted, Sequence: 2},
+		{From: "0x123", To: "0x789", Hash: "recent", BlockNumber: 95, Sequence: 3},
+		{From: "0x123", To: "0x456", Hash: "tip", BlockNumber: 100, Sequence: 4},
+	})
+
+	service := EthereumRPC{
+		Storage: newTestStorage(nil, transactions),
+		Methods: mockClient,
+	}
+
+	mockClient.On("GetCurrentBlock").Return(100)
+	mockClient.On("GetBlockNumberByTag", entities.FinalityFinalized).Return(int64(85), nil)
+
+	latest, err := service.GetTransactions("0x123")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old", "gone", "recent", "tip"}, hashes(latest))
+	assert.Equal(t, int64(21), latest[0].Confirmations)
+	assert.Equal(t, int64(1), latest[3].Confirmations)
+
+	confirmed, err := service.GetTransactionsWithFinality("0x123", entities.Finality{Confirmations: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old", "gone", "recent"}, hashes(confirmed))
+	assert.Equal(t, int64(6), confirmed[2].Confirmations)
+
+	finalized, err := service.GetTransactionsWithFinality("0x123", entities.Finality{Tag: entities.FinalityFinalized})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old", "gone"}, hashes(finalized), "reverted transactions are reported regardless of finality")
+
+	service.Finality = entities.Finality{Tag: entities.FinalityFinalized}
+	unconfirmed, err := entities.ParseFinality("0")
+	assert.NoError(t, err)
+	all, err := service.GetTransactionsWithFinality("0x123", unconfirmed)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old", "gone", "recent", "tip"}, hashes(all), "zero confirmations is not the service default")
+}
+
+func TestGetTransactionsAfterUsesTrackedHead(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	transactions := storages.NewTransactionStorage()
+	transactions.Save("0x123", []entities.Transaction{
+		{From: "0x789", To: "0x123", Hash: "old", BlockNumber: 80, Sequence: 1},
+		{From: "0x123", To: "0x789", Hash: "recent", BlockNumber: 95, Sequence: 2},
+	})
+	service := EthereumRPC{
+		Storage: newTestStorage(nil, transactions),
+		Methods: mockClient,
+		head:    100,
+	}
+	mockClient.On("GetBlockNumberByTag", entities.FinalityFinalized).Return(int64(85), nil)
+
+	for i := 0; i < 3; i++ {
+		finalized, err := service.GetTransactionsWithFinality("0x123", entities.Finality{Tag: entities.FinalityFinalized})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"old"}, hashes(finalized))
+		assert.Equal(t, int64(21), finalized[0].Confirmations)
+	}
+	mockClient.AssertNotCalled(t, "GetCurrentBlock")
+	mockClient.AssertNumberOfCalls(t, "GetBlockNumberByTag", 1)
+
+	service.head = 101
+	_, err := service.GetTransactionsWithFinality("0x123", entities.Finality{Tag: entities.FinalityFinalized})
+	assert.NoError(t, err)
+	mockClient.AssertNumberOfCalls(t, "GetBlockNumberByTag", 2)
+}
+
+func TestGetTransactionsAfterStopsAtUnconfirmed(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	transactions := storages.NewTransactionStorage()
+	transactions.Save("0x123", []entities.Transaction{
+		{Hash: "confirmed", BlockNumber: 80, Sequence: 1},
+		{Hash: "pending", BlockNumber: 99, Sequence: 2},
+		{Hash: "gone", BlockNumber: 90, Status: entities.TransactionStatusReverted, Sequence: 3},
+	})
+
+	service := EthereumRPC{
+		Storage: newTestStorage(nil, transactions),
+		Methods: mockClient,
+	}
+	mockClient.On("GetCurrentBlock").Return(100)
+
+	result, err := service.GetTransactionsAfter("0x123", entities.DefaultConsumer, 0, entities.Finality{Confirmations: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"confirmed"}, hashes(result), "acknowledging the result must not skip the pending transaction")
+
+	result, err = service.GetTransactionsAfter("0x123", entities.DefaultConsumer, 1, entities.Finality{Tag: entities.FinalityLatest})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pending", "gone"}, hashes(result))
+}
+
+func TestAcknowledgeTransactions(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	transactions := storages.NewTransactionStorage()
+	subscriptions.Save("0x123", int64(100))
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	mockClient.On("GetCurrentBlock").Return(102)
+	mockClient.On("GetBlocksByNumber", []int64{101, 102}, entities.PriorityTip).Return([]*entities.Block{
+		{Number: 101, Transactions: []entities.Transaction{{From: "0x123", To: "0x456", Hash: "h1"}}},
+		{Number: 102, Transactions: []entities.Transaction{{From: "0x456", To: "0x123", Hash: "h2"}}},
+	}, nil)
+	service.processBlocksUpTo(102)
+
+	// Reading does not remove anything
+	first, err := service.GetTransactions("0x123")
+	assert.NoError(t, err)
+	again, err := service.GetTransactions("0x123")
+	assert.NoError(t, err)
+	assert.Equal(t, first, again)
+	assert.Equal(t, []uint64{1, 2}, sequences(first))
+
+	// Reading from a cursor skips what the client already saw without acknowledging it
+	page, err := service.GetTransactionsAfter("0x123", entities.DefaultConsumer, 1, entities.Finality{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"h2"}, hashes(page))
+
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", entities.DefaultConsumer, 1))
+	stored, _, _ := transactions.Find("0x123")
+	assert.Equal(t, []string{"h2"}, hashes(stored), "acknowledged transactions are removed")
+	remaining, err := service.GetTransactions("0x123")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"h2"}, hashes(remaining))
+
+	// Acknowledging an older sequence again is a no-op
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", entities.DefaultConsumer, 1))
+
+	err = service.AcknowledgeTransactions("0x123", entities.DefaultConsumer, 3)
+	assert.ErrorIs(t, err, entities.ErrSequenceNotAssigned)
+	err = service.AcknowledgeTransactions("0x999", entities.DefaultConsumer, 1)
+	assert.ErrorIs(t, err, entities.ErrStreamNotFound)
+
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", entities.DefaultConsumer, 2))
+	remaining, err = service.GetTransactions("0x123")
+	assert.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestConsumersAcknowledgeIndependently(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	transactions := storages.NewTransactionStorage()
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	mockClient.On("GetCurrentBlock").Return(100).Times(3)
+	assert.True(t, subscribeConsumer(t, &service, "0x123", "mobile"))
+	assert.False(t, subscribeConsumer(t, &service, "0x123", "mobile"), "the consumer is already subscribed")
+	assert.True(t, subscribeConsumer(t, &service, "0x123", "analytics"), "a new consumer of a known address")
+
+	mockClient.On("GetCurrentBlock").Return(102)
+	mockClient.On("GetBlocksByNumber", []int64{101, 102}, entities.PriorityTip).Return([]*entities.Block{
+		{Number: 101, Transactions: []entities.Transaction{{From: "0x123", To: "0x456", Hash: "h1"}}},
+		{Number: 102, Transactions: []entities.Transaction{{From: "0x456", To: "0x123", Hash: "h2"}}},
+	}, nil)
+	service.processBlocksUpTo(102)
+
+	_, err := service.GetTransactionsAfter("0x123", entities.DefaultConsumer, 0, entities.Finality{})
+	assert.ErrorIs(t, err, entities.ErrConsumerNotFound, "only named consumers were subscribed")
+
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", "mobile", 2))
+	mobile, err := service.GetTransactionsAfter("0x123", "mobile", 0, entities.Finality{})
+	assert.NoError(t, err)
+	assert.Empty(t, mobile)
+	analytics, err := service.GetTransactionsAfter("0x123", "analytics", 0, entities.Finality{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"h1", "h2"}, hashes(analytics), "acknowledgements of one consumer do not affect the others")
+
+	// A late consumer starts from the oldest transaction still stored
+	assert.True(t, subscribeConsumer(t, &service, "0x123", "audit"))
+	audit, err := service.GetTransactionsAfter("0x123", "audit", 0, entities.Finality{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"h1", "h2"}, hashes(audit))
+
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", "analytics", 1))
+	assert.NoError(t, service.AcknowledgeTransactions("0x123", "audit", 2))
+	stored, _, _ := transactions.Find("0x123")
+	assert.Equal(t, []string{"h2"}, hashes(stored), "transactions are removed once every consumer acknowledged them")
+
+	err = service.AcknowledgeTransactions("0x123", "unknown", 1)
+	assert.ErrorIs(t, err, entities.ErrConsumerNotFound)
+}
+
+func TestMakeBatchRPCRequest(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service := EthereumRPC{Methods: mockClient}
+
+	// Responses arrive out of order and the second call fails
+	responseBody := `[
+		{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"header not found"}},
+		{"jsonrpc":"2.0","id":1,"result":"0x5ba"}
+	]`
+	mockClient.On("MakeRPCRequestWithCalls", `[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]},{"jsonrpc":"2.0","id":2,"method":"eth_getBlockByNumber","params":["0x1",true]},{"jsonrpc":"2.0","id":3,"method":"eth_chainId","params":[]}]`, 3, entities.PriorityTip).Return(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewReader([]byte(responseBody))),
+	}, nil)
+
+	results, err := service.MakeBatchRPCRequest([]entities.RPCCall{
+		{Method: "eth_blockNumber"},
+		{Method: "eth_getBlockByNumber", Params: []interface{}{"0x1", true}},
+		{Method: "eth_chainId"},
+	}, entities.PriorityTip)
+	assert.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.JSONEq(t, `"0x5ba"`, string(results[0].Result))
+	assert.Nil(t, results[0].Error)
+	assert.Equal(t, -32000, results[1].Error.Code)
+	assert.NotNil(t, results[2].Error, "a call without a response should surface an error")
+}
+
+func TestGetBlocksByNumber(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service := EthereumRPC{Methods: mockClient}
+
+	mockClient.On("MakeBatchRPCRequest", mock.Anything, entities.PriorityBackfill).Return([]entities.RPCResult{
+		{Result: []byte(`{"hash":"a5","parentHash":"a4","transactions":[{"from":"0x1","to":"0x2","value":"0x0","hash":"h1"}]}`)},
+		{Error: &entities.RPCError{Code: -32000, Message: "header not found"}},
+		{Result: []byte(`{"hash":"a7","parentHash":"a6","transactions":[]}`)},
+	}, nil)
+
+	blocks, err := service.GetBlocksByNumber([]int64{5, 6, 7}, entities.PriorityBackfill)
+	assert.Error(t, err)
+	assert.Len(t, blocks, 1, "only the blocks before the failed call are returned")
+	assert.Equal(t, "a5", blocks[0].Hash)
+	assert.Equal(t, int64(5), blocks[0].Transactions[0].BlockNumber)
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// Option customizes an EthereumRPC created by NewEthereumRPC.
+type Option func(rpc *EthereumRPC)
+
+// WithFinality sets the finality GetTransactions uses when the caller does not request one.
+func WithFinality(finality entities.Finality) Option {
+	return func(rpc *EthereumRPC) {
+		rpc.Finality = finality
+	}
+}
+
+// WithMaxSubscriptions refuses to subscribe new addresses once limit of them are subscribed.
+func WithMaxSubscriptions(limit int) Option {
+	return func(rpc *EthereumRPC) {
+		rpc.MaxSubscriptions = limit
+	}
+}
+
+// WithHeadSource makes the watcher follow heads from source, polling over HTTP while it is unavailable.
+func WithHeadSource(source interfaces.HeadSource) Option {
+	return func(rpc *EthereumRPC) {
+		rpc.HeadSource = source
+	}
+}
+
+// WithRateLimits sets the request budget of the providers, keyed by url.
+func WithRateLimits(limits map[string]RateLimit) Option {
+	return func(rpc *EthereumRPC) {
+		for url, limit := range limits {
+			rpc.Providers.SetRateLimit(url, limit)
+		}
+	}
+}
+
+// WithTracers sets the tracing API supported by the providers, keyed by url.
+func WithTracers(tracers map[string]string) Option {
+	return func(rpc *EthereumRPC) {
+		for url, tracer := range tracers {
+			rpc.Providers.SetTracer(url, tracer)
+		}
+	}
+}
+
+// WithNotificationTransport notifies the registered devices of the transactions of their address through transport.
+func WithNotificationTransport(transport interfaces.NotificationTransport) Option {
+	return func(rpc *EthereumRPC) {
+		rpc.NotificationTransport = transport
+	}
+}
+
+// WithMempool records the mempool transactions of subscribed addresses, announced by the newPendingTransactions
+// subscription of a WebSocketHeadSource, or found by polling txpool_content without one.
+func WithMempool() Option {
+	return func(rpc *EthereumRPC) {
+		rpc.mempool = true
+	}
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+const (
+	defaultMaxHeadLag          = 5 // Blocks a provider may trail the highest observed head
+	latencySmoothing           = 0.2
+	errorRateSmoothing         = 0.2
+	errorRatePenalty           = 10 // How much a 100% error rate multiplies the latency score
+	errorRateBaseline          = float64(time.Second)
+	defaultHealthCheckInterval = 10 * time.Second
+)
+
+// provider tracks the health of a single RPC endpoint.
+type provider struct {
+	url                 string
+	latency             time.Duration
+	errorRate           float64
+	head                int64
+	requests            int64
+	failures            int64
+	consecutiveFailures int64
+	lastError           string
+	breaker             *circuitBreaker
+	limiter             *rateLimiter
+	tracer              string
+}
+
+// ProviderPool routes requests to the healthiest RPC provider and fails over to the next one when
+// a provider errors, times out or falls behind the highest observed head. When every provider
+// failed with a retryable error, the request is tried again after an exponential backoff.
+type ProviderPool struct {
+	Client     interfaces.HTTPClient
+	MaxHeadLag int64
+	Retry      RetryPolicy
+
+	mu          sync.Mutex
+	providers   []*provider
+	highestHead int64
+}
+
+func NewProviderPool(urls []string, client interfaces.HTTPClient) *ProviderPool {
+	pool := &ProviderPool{
+		Client:     client,
+		MaxHeadLag: defaultMaxHeadLag,
+		Retry:      defaultRetryPolicy,
+	}
+	for _, url := range urls {
+		pool.providers = append(pool.providers, &provider{
+			url:     url,
+			breaker: newCircuitBreaker(defaultCircuitThreshold, defaultCircuitCooldown),
+		})
+	}
+	return pool
+}
+
+// SetRateLimit gives a provider a request budget, calls then wait in their priority lane for it.
+func (p *ProviderPool) SetRateLimit(url string, limit RateLimit) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			provider.limiter = newRateLimiter(limit)
+		}
+	}
+}
+
+// SetTracer declares the tracing API a provider supports, one of TracerCallTracer or TracerTraceBlock.
+// Traces are only requested from providers with a tracer.
+func (p *ProviderPool) SetTracer(url string, tracer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			provider.tracer = tracer
+		}
+	}
+}
+
+// Tracing reports whether any provider is able to trace.
+func (p *ProviderPool) Tracing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.tracer != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Do sends data to the providers in health order until one of them answers, backing off and
+// starting over while the failures are retryable. Rate limited providers are waited for in the
+// lane of the given priority, and skipped once their daily quota is spent.
+func (p *ProviderPool) Do(data string, priority entities.Priority) (*http.Response, error) {
+	return p.DoBatch(data, 1, priority)
+}
+
+// DoBatch sends data like Do, charging it as calls requests against the rate limits since providers
+// bill every call of a JSON-RPC batch.
+func (p *ProviderPool) DoBatch(data string, calls int, priority entities.Priority) (*http.Response, error) {
+	attempts := p.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	lastErr := fmt.Errorf("no RPC providers configured")
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if !IsRetryable(lastErr) {
+				break
+			}
+			time.Sleep(p.Retry.backoff(attempt))
+		}
+
+		for _, url := range p.ranked() {
+			resp, err := p.try(url, data, calls, priority)
+			if err == nil {
+				return resp, nil
+			}
+			lastErr = err
+		}
+	}
+	return nil, lastErr
+}
+
+// DoTrace sends the request built by data for the tracer of each provider able to trace, in health
+// order, until one of them answers. It returns the tracer of the provider that answered.
+func (p *ProviderPool) DoTrace(data func(tracer string) string, priority entities.Priority) (*http.Response, string, error) {
+	lastErr := fmt.Errorf("no RPC provider supports tracing")
+	for _, url := range p.ranked() {
+		tracer := p.tracer(url)
+		if tracer == "" {
+			continue
+		}
+		resp, err := p.try(url, data(tracer), 1, priority)
+		if err == nil {
+			return resp, tracer, nil
+		}
+		lastErr = err
+	}
+	return nil, "", lastErr
+}
+
+// try sends data to a single provider unless its circuit is open or its daily quota is spent.
+func (p *ProviderPool) try(url string, data string, calls int, priority entities.Priority) (*http.Response, error) {
+	if !p.allow(url) {
+		return nil, &RequestError{Kind: ErrorKindCircuitOpen, Provider: url, Err: fmt.Errorf("circuit open")}
+	}
+	if limiter := p.limiter(url); limiter != nil {
+		if err := limiter.wait(priority, calls); err != nil {
+			// Nothing was sent, a trial of a half-open circuit is left for the next request
+			p.release(url)
+			return nil, &RequestError{Kind: ErrorKindQuotaExceeded, Provider: url, Err: err}
+		}
+	}
+	return p.send(url, data)
+}
+
+// StartHealthChecks polls eth_blockNumber on every provider to refresh latency and head lag.
+func (p *ProviderPool) StartHealthChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		p.CheckHealth()
+		<-ticker.C
+	}
+}
+
+// CheckHealth queries the head of every provider once.
+func (p *ProviderPool) CheckHealth() {
+	p.mu.Lock()
+	urls := make([]string, len(p.providers))
+	for i, provider := range p.providers {
+		urls[i] = provider.url
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			// Health checks bypass the rate limiter but still count against the daily quota
+			if limiter := p.limiter(url); limiter != nil {
+				limiter.consume()
+			}
+			resp, err := p.send(url, `{"jsonrpc":"2.0", "method":"eth_blockNumber", "params":[], "id":1}`)
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+
+			var result struct {
+				Result string `json:"result"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				p.recordFailure(url, &RequestError{Kind: ErrorKindRPC, Provider: url, Err: err})
+				return
+			}
+			head, err := strconv.ParseInt(result.Result, 0, 64)
+			if err != nil {
+				p.recordFailure(url, &RequestError{Kind: ErrorKindRPC, Provider: url, Err: err})
+				return
+			}
+			p.ObserveHead(url, head)
+		}(url)
+	}
+	wg.Wait()
+}
+
+// ObserveHead records the head reported by a provider.
+func (p *ProviderPool) ObserveHead(url string, head int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			provider.head = head
+		}
+	}
+	if head > p.highestHead {
+		p.highestHead = head
+	}
+}
+
+// Health returns a snapshot of every provider, healthiest first.
+func (p *ProviderPool) Health() []entities.ProviderHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var health []entities.ProviderHealth
+	for _, provider := range p.sortedProviders() {
+		var usage *entities.RateLimitUsage
+		if provider.limiter != nil {
+			usage = provider.limiter.usage()
+		}
+		health = append(health, entities.ProviderHealth{
+			URL:                 provider.url,
+			Healthy:             p.isHealthy(provider),
+			LatencyMs:           float64(provider.latency) / float64(time.Millisecond),
+			ErrorRate:           provider.errorRate,
+			Head:                provider.head,
+			HeadLag:             p.headLag(provider),
+			Requests:            provider.requests,
+			Failures:            provider.failures,
+			ConsecutiveFailures: provider.consecutiveFailures,
+			Circuit:             provider.breaker.state,
+			RateLimit:           usage,
+			LastError:           provider.lastError,
+			Tracer:              provider.tracer,
+		})
+	}
+	return health
+}
+
+// send posts data to a single provider and classifies its failures. JSON-RPC errors that are
+// worth retrying elsewhere count as failures, other JSON-RPC errors are left to the caller.
+func (p *ProviderPool) send(url string, data string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBufferString(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, p.recordFailure(url, &RequestError{Kind: ErrorKindTransport, Provider: url, Err: err})
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, p.recordFailure(url, &RequestError{Kind: ErrorKindTransport, Provider: url, Err: err})
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, p.recordFailure(url, &RequestError{Kind: ErrorKindRateLimit, Provider: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("answered %s", resp.Status)})
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, p.recordFailure(url, &RequestError{Kind: ErrorKindHTTPStatus, Provider: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("answered %s", resp.Status)})
+	}
+
+	var rpcResponse struct {
+		Error *entities.RPCError `json:"error"`
+	}
+	if json.Unmarshal(body, &rpcResponse) == nil && rpcResponse.Error != nil {
+		switch rpcResponse.Error.Code {
+		case rpcCodeLimitExceeded:
+			return nil, p.recordFailure(url, &RequestError{Kind: ErrorKindRateLimit, Provider: url, Code: rpcResponse.Error.Code, Err: rpcResponse.Error})
+		case rpcCodeInternalError:
+			return nil, p.recordFailure(url, &RequestError{Kind: ErrorKindRPC, Provider: url, Code: rpcResponse.Error.Code, Err: rpcResponse.Error})
+		}
+	}
+
+	p.recordSuccess(url, time.Since(start))
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (p *ProviderPool) allow(url string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			return provider.breaker.allow()
+		}
+	}
+	return false
+}
+
+func (p *ProviderPool) release(url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			provider.breaker.release()
+		}
+	}
+}
+
+func (p *ProviderPool) tracer(url string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			return provider.tracer
+		}
+	}
+	return ""
+}
+
+func (p *ProviderPool) limiter(url string) *rateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url == url {
+			return provider.limiter
+		}
+	}
+	return nil
+}
+
+func (p *ProviderPool) recordSuccess(url string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url != url {
+			continue
+		}
+		provider.requests++
+		provider.consecutiveFailures = 0
+		provider.breaker.success()
+		provider.errorRate = (1 - errorRateSmoothing) * provider.errorRate
+		if provider.latency == 0 {
+			provider.latency = latency
+		} else {
+			provider.latency = time.Duration((1-latencySmoothing)*float64(provider.latency) + latencySmoothing*float64(latency))
+		}
+	}
+}
+
+func (p *ProviderPool) recordFailure(url string, err *RequestError) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, provider := range p.providers {
+		if provider.url != url {
+			continue
+		}
+		provider.requests++
+		provider.failures++
+		provider.consecutiveFailures++
+		provider.breaker.failure()
+		provider.errorRate = (1-errorRateSmoothing)*provider.errorRate + errorRateSmoothing
+		provider.lastError = err.Error()
+	}
+	return err
+}
+
+// ranked returns the provider urls in the order requests should try them.
+func (p *ProviderPool) ranked() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var urls []string
+	for _, provider := range p.sortedProviders() {
+		urls = append(urls, provider.url)
+	}
+	return urls
+}
+
+// sortedProviders orders healthy providers before unhealthy ones, then by latency weighted by error rate.
+func (p *ProviderPool) sortedProviders() []*provider {
+	sorted := make([]*provider, len(p.providers))
+	copy(sorted, p.providers)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		healthyI, healthyJ := p.isHealthy(sorted[i]), p.isHealthy(sorted[j])
+		if healthyI != healthyJ {
+			return healthyI
+		}
+		return score(sorted[i]) < score(sorted[j])
+	})
+	return sorted
+}
+
+func (p *ProviderPool) isHealthy(provider *provider) bool {
+	return provider.breaker.state == circuitClosed && p.headLag(provider) <= p.MaxHeadLag
+}
+
+func (p *ProviderPool) headLag(provider *provider) int64 {
+	if provider.head == 0 {
+		// The head of this provider was not observed yet
+		return 0
+	}
+	return p.highestHead - provider.head
+}
+
+// score is lower for better providers, errors count even when they failed fast.
+func score(provider *provider) float64 {
+	return float64(provider.latency)*(1+errorRatePenalty*provider.errorRate) + errorRateBaseline*provider.errorRate
+}
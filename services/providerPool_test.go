@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProviderStandIn answers every request with the given status and eth_blockNumber result.
+func newProviderStandIn(status int, head int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"0x%x"}`, head)
+	}))
+}
+
+func TestProviderPoolFailsOverOnServerErrors(t *testing.T) {
+	failing := newProviderStandIn(http.StatusBadGateway, 100)
+	defer failing.Close()
+	healthy := newProviderStandIn(http.StatusOK, 100)
+	defer healthy.Close()
+
+	pool := NewProviderPool([]string{failing.URL, healthy.URL}, &http.Client{})
+
+	resp, err := pool.Do(`{"jsonrpc":"2.0","method":"eth_blockNumber","params":[],"id":1}`, entities.PriorityTip)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(body), "0x64")
+
+	health := pool.Health()
+	require.Len(t, health, 2)
+	assert.Equal(t, healthy.URL, health[0].URL, "the provider that answered should rank first")
+	assert.Equal(t, int64(1), health[1].Failures)
+	assert.Contains(t, health[1].LastError, "502")
+}
+
+func TestProviderPoolSkipsLaggingProviders(t *testing.T) {
+	lagging := newProviderStandIn(http.StatusOK, 90)
+	defer lagging.Close()
+	leading := newProviderStandIn(http.StatusOK, 100)
+	defer leading.Close()
+
+	pool := NewProviderPool([]string{lagging.URL, leading.URL}, &http.Client{})
+	pool.CheckHealth()
+
+	health := pool.Health()
+	require.Len(t, health, 2)
+	assert.Equal(t, leading.URL, health[0].URL)
+	assert.True(t, health[0].Healthy)
+	assert.Equal(t, lagging.URL, health[1].URL)
+	assert.False(t, health[1].Healthy, "a provider 10 blocks behind should be unhealthy")
+	assert.Equal(t, int64(10), health[1].HeadLag)
+}
+
+func TestProviderPoolReturnsLastErrorWhenAllFail(t *testing.T) {
+	failing := newProviderStandIn(http.StatusTooManyRequests, 0)
+	defer failing.Close()
+
+	pool := NewProviderPool([]string{failing.URL}, &http.Client{})
+	pool.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	_, err := pool.Do(`{}`, entities.PriorityTip)
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, ErrorKindRateLimit, requestErr.Kind)
+	assert.True(t, requestErr.Retryable())
+}
+
+func TestProviderPoolRetriesWithBackoff(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fails twice with a JSON-RPC rate limit error before answering
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"limit exceeded"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`)
+	}))
+	defer server.Close()
+
+	pool := NewProviderPool([]string{server.URL}, &http.Client{})
+	pool.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	resp, err := pool.Do(`{}`, entities.PriorityTip)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestProviderPoolDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	pool := NewProviderPool([]string{server.URL}, &http.Client{})
+	pool.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	_, err := pool.Do(`{}`, entities.PriorityTip)
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, ErrorKindHTTPStatus, requestErr.Kind)
+	assert.Equal(t, http.StatusUnauthorized, requestErr.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "client errors should not be retried")
+}
+
+func TestProviderPoolOpensCircuit(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pool := NewProviderPool([]string{server.URL}, &http.Client{})
+	pool.Retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	_, err := pool.Do(`{}`, entities.PriorityTip)
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, ErrorKindCircuitOpen, requestErr.Kind)
+	assert.Equal(t, int32(defaultCircuitThreshold), atomic.LoadInt32(&calls), "no request should reach a provider with an open circuit")
+	assert.Equal(t, circuitOpen, pool.Health()[0].Circuit)
+}
+
+func TestProviderPoolReleasesTrialWhenQuotaIsSpent(t *testing.T) {
+	server := newProviderStandIn(http.StatusOK, 100)
+	defer server.Close()
+
+	pool := NewProviderPool([]string{server.URL}, &http.Client{})
+	pool.SetRateLimit(server.URL, RateLimit{RequestsPerSecond: 1000, Burst: 100, DailyQuota: 1})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := pool.limiter(server.URL)
+	limiter.now = func() time.Time { return now }
+	require.NoError(t, limiter.wait(entities.PriorityTip, 1))
+
+	// The circuit waited out its cooldown, so the next request is its trial
+	breaker := pool.providers[0].breaker
+	breaker.state = circuitOpen
+	breaker.openedAt = time.Now().Add(-2 * defaultCircuitCooldown)
+
+	_, err := pool.Do(`{}`, entities.PriorityTip)
+	var requestErr *RequestError
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, ErrorKindQuotaExceeded, requestErr.Kind)
+
+	// Once the quota is renewed, the provider is tried again and recovers
+	now = now.Add(24 * time.Hour)
+	resp, err := pool.Do(`{}`, entities.PriorityTip)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, circuitClosed, pool.Health()[0].Circuit)
+}
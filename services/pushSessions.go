@@ -0,0 +1,307 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/websockets"
+)
+
+const (
+	pushQueueSize           = 256              // Messages waiting to be written to a connection
+	pushSlowConsumerTimeout = 10 * time.Second // Time a full queue may block before the connection is closed
+	pushWriteTimeout        = 10 * time.Second // Time a single message may take to be written
+	pushPingInterval        = 30 * time.Second // Time between pings detecting dead connections
+	pushMaxAddresses        = 10000            // Addresses a single connection may follow
+)
+
+// errSlowConsumer closes connections that do not read their messages fast enough.
+var errSlowConsumer = errors.New("slow consumer")
+
+// pushSession multiplexes the transactions of the addresses a WebSocket client subscribed to. A single loop
+// reads the transactions of the addresses signalled ready and feeds a bounded queue drained by a single
+// writer, so a client that falls behind first blocks it, then gets disconnected.
+type pushSession struct {
+	parser    interfaces.Parser
+	conn      *websockets.Conn
+	watch     interfaces.TransactionWatch
+	send      chan entities.PushMessage
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	follows map[string]*pushFollow
+}
+
+// pushFollow is the interest of a session in an address. Its cursor is only used by the push loop.
+type pushFollow struct {
+	consumer string
+	finality entities.Finality
+	cursor   uint64
+}
+
+// ServePushSession speaks the WebSocket push API on conn until the client disconnects or falls behind.
+// Subscribing subscribes the consumer to the addresses and pushes their transactions from its last
+// acknowledged one. These subscriptions outlive the connection so a reconnecting client resumes where it
+// left off, unsubscribing only stops pushing the addresses on this connection.
+func ServePushSession(conn *websockets.Conn, parser interfaces.Parser) {
+	session := &pushSession{
+		parser:  parser,
+		conn:    conn,
+		watch:   parser.WatchAddresses(),
+		send:    make(chan entities.PushMessage, pushQueueSize),
+		done:    make(chan struct{}),
+		follows: make(map[string]*pushFollow),
+	}
+	defer session.watch.Stop()
+	go session.writeMessages()
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		session.pushTransactions()
+	}()
+
+	for {
+		var request entities.PushRequest
+		message, err := conn.ReadMessage()
+		if err != nil {
+			session.close(nil)
+			break
+		}
+		if err := json.Unmarshal(message, &request); err != nil {
+			session.reply(entities.PushMessage{Type: entities.PushTypeError, Error: "invalid JSON: " + err.Error()})
+			continue
+		}
+		session.handle(request)
+	}
+
+	<-pushed
+}
+
+func (s *pushSession) handle(request entities.PushRequest) {
+	var err error
+	switch request.Type {
+	case entities.PushTypePing:
+		s.reply(entities.PushMessage{ID: request.ID, Type: entities.PushTypePong})
+		return
+	case entities.PushTypeSubscribe:
+		err = s.subscribe(request)
+	case entities.PushTypeUnsubscribe:
+		s.unsubscribe(request.Addresses)
+	case entities.PushTypeAck:
+		err = s.acknowledge(request)
+	default:
+		err = fmt.Errorf("unknown message type %q", request.Type)
+	}
+
+	if err != nil {
+		s.reply(entities.PushMessage{ID: request.ID, Type: entities.PushTypeError, Error: err.Error()})
+		return
+	}
+	s.reply(entities.PushMessage{ID: request.ID, Type: entities.PushTypeResult})
+}
+
+// subscribe subscribes the consumer to every address at once and follows those that succeeded. Each
+// address that failed gets its own error message, and the request fails.
+func (s *pushSession) subscribe(request entities.PushRequest) error {
+	if len(request.Addresses) == 0 {
+		return errors.New("addresses are required")
+	}
+	var finality entities.Finality
+	if request.Finality != "" {
+		parsed, err := entities.ParseFinality(request.Finality)
+		if err != nil {
+			return err
+		}
+		finality = parsed
+	}
+	for _, address := range request.Addresses {
+		if address == "" {
+			return errors.New("address is required")
+		}
+	}
+
+	// Requests are handled one at a time, so the count cannot grow before the addresses are followed
+	s.mu.Lock()
+	followed := len(s.follows)
+	s.mu.Unlock()
+	if followed+len(request.Addresses) > pushMaxAddresses {
+		return fmt.Errorf("a connection follows at most %d addresses", pushMaxAddresses)
+	}
+
+	changes := make([]entities.SubscriptionChange, len(request.Addresses))
+	for i, address := range request.Addresses {
+		changes[i] = entities.SubscriptionChange{Address: address, Consumer: request.Consumer}
+	}
+	results := s.parser.SubscribeAll(changes)
+
+	var failed []entities.SubscriptionChangeResult
+	s.mu.Lock()
+	for _, result := range results {
+		if result.Error != "" {
+			failed = append(failed, result)
+			continue
+		}
+		s.follows[result.Address] = &pushFollow{consumer: request.Consumer, finality: finality, cursor: request.Cursor}
+		s.watch.Add(result.Address)
+	}
+	s.mu.Unlock()
+
+	for _, result := range failed {
+		s.reply(entities.PushMessage{ID: request.ID, Type: entities.PushTypeError, Address: result.Address, Error: result.Error})
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d addresses could not be subscribed", len(failed), len(results))
+	}
+	return nil
+}
+
+func (s *pushSession) unsubscribe(addresses []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, address := range addresses {
+		if _, exists := s.follows[address]; exists {
+			s.watch.Remove(address)
+			delete(s.follows, address)
+		}
+	}
+}
+
+// acknowledge acknowledges for the consumer the address is followed with, or the one of the request.
+func (s *pushSession) acknowledge(request entities.PushRequest) error {
+	consumer := request.Consumer
+	s.mu.Lock()
+	if follow, exists := s.follows[request.Address]; exists {
+		consumer = follow.consumer
+	}
+	s.mu.Unlock()
+	return s.parser.AcknowledgeTransactions(request.Address, consumer, request.Sequence)
+}
+
+// pushTransactions pushes the transactions of the followed addresses as they are ready until the session
+// ends.
+func (s *pushSession) pushTransactions() {
+	for {
+		select {
+		case <-s.watch.Signal():
+		case <-s.done:
+			return
+		}
+		for _, address := range s.watch.Ready() {
+			if !s.push(address) {
+				return
+			}
+		}
+	}
+}
+
+// push queues the transactions of address after the cursor of its follow, and reports whether the
+// session is still open.
+func (s *pushSession) push(address string) bool {
+	follow := s.currentFollow(address, nil)
+	if follow == nil {
+		return true
+	}
+	transactions, err := s.parser.GetTransactionsAfter(address, follow.consumer, follow.cursor, follow.finality)
+	if errors.Is(err, entities.ErrConsumerNotFound) {
+		s.mu.Lock()
+		if s.follows[address] == follow {
+			s.watch.Remove(address)
+			delete(s.follows, address)
+		}
+		s.mu.Unlock()
+		return s.enqueue(entities.PushMessage{Type: entities.PushTypeError, Address: address, Error: err.Error()})
+	}
+	for i := range transactions {
+		// Addresses unsubscribed, or subscribed again, meanwhile never push what was read for them
+		if s.currentFollow(address, follow) == nil {
+			return true
+		}
+		if !s.enqueue(entities.PushMessage{Type: entities.PushTypeTransaction, Address: address, Transaction: &transactions[i]}) {
+			return false
+		}
+		follow.cursor = transactions[i].Sequence
+	}
+	return true
+}
+
+// currentFollow returns the follow of address, or nil when there is none or it is not the expected one.
+func (s *pushSession) currentFollow(address string, expected *pushFollow) *pushFollow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	follow := s.follows[address]
+	if expected != nil && follow != expected {
+		return nil
+	}
+	return follow
+}
+
+// reply queues a message for the client, dropping it once the session ended.
+func (s *pushSession) reply(message entities.PushMessage) {
+	s.enqueue(message)
+}
+
+// enqueue waits for room in the queue, closing the session when the client does not make any in time.
+// It reports whether the message was queued.
+func (s *pushSession) enqueue(message entities.PushMessage) bool {
+	select {
+	case s.send <- message:
+		return true
+	case <-s.done:
+		return false
+	default:
+	}
+
+	timer := time.NewTimer(pushSlowConsumerTimeout)
+	defer timer.Stop()
+	select {
+	case s.send <- message:
+		return true
+	case <-s.done:
+		return false
+	case <-timer.C:
+		s.close(errSlowConsumer)
+		return false
+	}
+}
+
+// writeMessages writes the queued messages in order, and pings the client while it is idle.
+func (s *pushSession) writeMessages() {
+	ping := time.NewTicker(pushPingInterval)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case message := <-s.send:
+			if err = s.conn.SetWriteDeadline(time.Now().Add(pushWriteTimeout)); err == nil {
+				err = s.conn.WriteJSON(message)
+			}
+		case <-ping.C:
+			if err = s.conn.SetWriteDeadline(time.Now().Add(pushWriteTimeout)); err == nil {
+				err = s.conn.Ping()
+			}
+		case <-s.done:
+			return
+		}
+		if err != nil {
+			s.close(err)
+			return
+		}
+	}
+}
+
+// close ends the session once, which also unblocks the pending read of ServePushSession.
+func (s *pushSession) close(reason error) {
+	s.closeOnce.Do(func() {
+		if reason != nil {
+			fmt.Println("Closing push connection:", reason)
+		}
+		close(s.done)
+		s.conn.Close()
+	})
+}
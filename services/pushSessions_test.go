@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/websockets"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readPushMessage(t *testing.T, conn *websockets.Conn) entities.PushMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var message entities.PushMessage
+	require.NoError(t, conn.ReadJSON(&message))
+	return message
+}
+
+func TestPushSessionMultiplexesAddresses(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	service := &EthereumRPC{
+		Storage:  storages.NewMemoryStorage(),
+		Methods:  mockClient,
+		Finality: entities.Finality{Tag: entities.FinalityLatest},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websockets.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		ServePushSession(conn, service)
+	}))
+	defer server.Close()
+
+	conn, err := websockets.Dial("ws"+strings.TrimPrefix(server.URL, "http"), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(entities.PushRequest{ID: json.RawMessage(`1`), Type: entities.PushTypeSubscribe, Addresses: []string{wallet, sender}, Consumer: "app"}))
+	assert.Equal(t, entities.PushMessage{ID: json.RawMessage(`1`), Type: entities.PushTypeResult}, readPushMessage(t, conn))
+	cursor, err := service.consumerCursor(wallet, "app")
+	require.NoError(t, err, "subscribing over the socket subscribes the consumer")
+	assert.Equal(t, uint64(0), cursor)
+
+	require.NoError(t, service.Events().Publish(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{{Hash: "0x1", From: sender, To: wallet, BlockNumber: 100}}}))
+	message := readPushMessage(t, conn)
+	assert.Equal(t, entities.PushTypeTransaction, message.Type)
+	assert.Equal(t, wallet, message.Address)
+	require.NotNil(t, message.Transaction)
+	assert.Equal(t, "0x1", message.Transaction.Hash)
+	assert.Equal(t, uint64(1), message.Transaction.Sequence)
+
+	require.NoError(t, conn.WriteJSON(entities.PushRequest{ID: json.RawMessage(`"ack"`), Type: entities.PushTypeAck, Address: wallet, Sequence: 1}))
+	assert.Equal(t, entities.PushMessage{ID: json.RawMessage(`"ack"`), Type: entities.PushTypeResult}, readPushMessage(t, conn))
+	cursor, err = service.consumerCursor(wallet, "app")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), cursor)
+
+	require.NoError(t, conn.WriteJSON(entities.PushRequest{Type: entities.PushTypeUnsubscribe, Addresses: []string{wallet}}))
+	assert.Equal(t, entities.PushTypeResult, readPushMessage(t, conn).Type)
+	require.NoError(t, service.Events().Publish(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{{Hash: "0x2", From: sender, To: wallet, BlockNumber: 100}}}))
+	require.NoError(t, service.Events().Publish(entities.TransactionMatched{Address: sender, Transactions: []entities.Transaction{{Hash: "0x2", From: sender, To: wallet, BlockNumber: 100}}}))
+	message = readPushMessage(t, conn)
+	assert.Equal(t, sender, message.Address, "unsubscribed addresses are no longer pushed")
+
+	require.NoError(t, conn.WriteJSON(entities.PushRequest{Type: "bogus"}))
+	assert.Equal(t, entities.PushTypeError, readPushMessage(t, conn).Type)
+	require.NoError(t, conn.WriteJSON(entities.PushRequest{ID: json.RawMessage(`7`), Type: entities.PushTypePing}))
+	assert.Equal(t, entities.PushMessage{ID: json.RawMessage(`7`), Type: entities.PushTypePong}, readPushMessage(t, conn))
+
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		service.watchersMu.Lock()
+		defer service.watchersMu.Unlock()
+		return len(service.watchers) == 0
+	}, 2*time.Second, 10*time.Millisecond, "watchers are released once the client disconnects")
+}
+
+func TestPushSessionReportsFailedSubscriptions(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	service := &EthereumRPC{
+		Storage:          storages.NewMemoryStorage(),
+		Methods:          mockClient,
+		Finality:         entities.Finality{Tag: entities.FinalityLatest},
+		MaxSubscriptions: 1,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websockets.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		ServePushSession(conn, service)
+	}))
+	defer server.Close()
+
+	conn, err := websockets.Dial("ws"+strings.TrimPrefix(server.URL, "http"), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(entities.PushRequest{ID: json.RawMessage(`1`), Type: entities.PushTypeSubscribe, Addresses: []string{wallet, sender}, Consumer: "app"}))
+	message := readPushMessage(t, conn)
+	assert.Equal(t, entities.PushTypeError, message.Type)
+	assert.Equal(t, sender, message.Address, "each address that failed is named")
+	message = readPushMessage(t, conn)
+	assert.Equal(t, entities.PushTypeError, message.Type, "the request fails")
+	assert.Equal(t, json.RawMessage(`1`), message.ID)
+
+	// The address that succeeded is still pushed
+	require.NoError(t, service.Events().Publish(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{{Hash: "0x1", From: sender, To: wallet, BlockNumber: 100}}}))
+	message = readPushMessage(t, conn)
+	assert.Equal(t, entities.PushTypeTransaction, message.Type)
+	assert.Equal(t, wallet, message.Address)
+}
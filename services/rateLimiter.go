@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// backfillQuotaShare is the share of the daily quota backfill calls may use, the rest is kept for the tip.
+const backfillQuotaShare = 0.9
+
+var errQuotaExceeded = errors.New("daily request quota exceeded")
+
+// RateLimit is the request budget of a provider. Zero values mean unlimited.
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+	DailyQuota        int64
+}
+
+// ParseRateLimit parses "<requests per second>:<burst>[:<daily quota>]", for example "10:20:100000".
+func ParseRateLimit(value string) (RateLimit, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected <rps>:<burst>[:<daily quota>]", value)
+	}
+
+	rps, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || rps <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid requests per second in %q", value)
+	}
+	burst, err := strconv.Atoi(parts[1])
+	if err != nil || burst < 1 {
+		return RateLimit{}, fmt.Errorf("invalid burst in %q", value)
+	}
+
+	limit := RateLimit{RequestsPerSecond: rps, Burst: burst}
+	if len(parts) == 3 {
+		limit.DailyQuota, err = strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || limit.DailyQuota < 0 {
+			return RateLimit{}, fmt.Errorf("invalid daily quota in %q", value)
+		}
+	}
+	return limit, nil
+}
+
+// rateLimiter is a token bucket with a daily quota, where tip calls are served before backfill calls.
+type rateLimiter struct {
+	limit           RateLimit
+	mu              sync.Mutex
+	tokens          float64
+	last            time.Time
+	day             time.Time
+	dailyUsed       int64
+	waitingTip      int
+	waitingBackfill int
+	now             func() time.Time
+	sleep           func(time.Duration)
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// wait blocks until a request of calls JSON-RPC calls with the given priority may be sent, or fails when
+// the quota cannot cover them. A batch takes its tokens once one is available, the following requests
+// wait for the bucket to refill from the debt.
+func (l *rateLimiter) wait(priority entities.Priority, calls int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.enqueue(priority, 1)
+	defer l.enqueue(priority, -1)
+
+	for {
+		l.refill()
+
+		if l.quotaExceeded(priority, calls) {
+			return errQuotaExceeded
+		}
+		if l.limit.RequestsPerSecond <= 0 {
+			l.dailyUsed += int64(calls)
+			return nil
+		}
+		if l.tokens >= 1 && (priority == entities.PriorityTip || l.waitingTip == 0) {
+			l.tokens -= float64(calls)
+			l.dailyUsed += int64(calls)
+			return nil
+		}
+
+		delay := time.Millisecond
+		if l.tokens < 1 {
+			delay = time.Duration((1 - l.tokens) / l.limit.RequestsPerSecond * float64(time.Second))
+		}
+		l.mu.Unlock()
+		l.sleep(delay)
+		l.mu.Lock()
+	}
+}
+
+// consume records a call that was sent without waiting for a token.
+func (l *rateLimiter) consume() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	l.dailyUsed++
+}
+
+func (l *rateLimiter) enqueue(priority entities.Priority, delta int) {
+	if priority == entities.PriorityTip {
+		l.waitingTip += delta
+	} else {
+		l.waitingBackfill += delta
+	}
+}
+
+func (l *rateLimiter) refill() {
+	now := l.now()
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(l.day) {
+		l.day = day
+		l.dailyUsed = 0
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.limit.RequestsPerSecond
+		if l.tokens > float64(l.limit.Burst) {
+			l.tokens = float64(l.limit.Burst)
+		}
+	}
+	l.last = now
+}
+
+// quotaExceeded reports whether calls more calls would go over the quota of priority.
+func (l *rateLimiter) quotaExceeded(priority entities.Priority, calls int) bool {
+	if l.limit.DailyQuota <= 0 {
+		return false
+	}
+	quota := float64(l.limit.DailyQuota)
+	if priority == entities.PriorityBackfill {
+		quota *= backfillQuotaShare
+	}
+	return float64(l.dailyUsed+int64(calls)) > quota
+}
+
+func (l *rateLimiter) usage() *entities.RateLimitUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	usage := &entities.RateLimitUsage{
+		RequestsPerSecond: l.limit.RequestsPerSecond,
+		Burst:             l.limit.Burst,
+		AvailableTokens:   l.tokens,
+		DailyQuota:        l.limit.DailyQuota,
+		DailyUsed:         l.dailyUsed,
+		WaitingTip:        l.waitingTip,
+		WaitingBackfill:   l.waitingBackfill,
+	}
+	if l.limit.DailyQuota > 0 {
+		usage.QuotaUsedPercent = float64(l.dailyUsed) / float64(l.limit.DailyQuota) * 100
+	}
+	return usage
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	limit, err := ParseRateLimit("10:20:100000")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimit{RequestsPerSecond: 10, Burst: 20, DailyQuota: 100000}, limit)
+
+	limit, err = ParseRateLimit("0.5:1")
+	require.NoError(t, err)
+	assert.Equal(t, RateLimit{RequestsPerSecond: 0.5, Burst: 1}, limit)
+
+	for _, invalid := range []string{"", "10", "x:1", "10:0", "10:1:-1", "1:2:3:4"} {
+		_, err := ParseRateLimit(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRateLimiterBurstAndRefill(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := newRateLimiter(RateLimit{RequestsPerSecond: 2, Burst: 2})
+	limiter.now = func() time.Time { return now }
+	var slept time.Duration
+	limiter.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	require.NoError(t, limiter.wait(entities.PriorityTip, 1))
+	require.NoError(t, limiter.wait(entities.PriorityTip, 1))
+	assert.Zero(t, slept, "the burst is served immediately")
+
+	require.NoError(t, limiter.wait(entities.PriorityTip, 1))
+	assert.Equal(t, 500*time.Millisecond, slept, "the next token arrives after 1/rps")
+	assert.Equal(t, int64(3), limiter.usage().DailyUsed)
+}
+
+func TestRateLimiterDailyQuota(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerSecond: 1000, Burst: 100, DailyQuota: 10})
+
+	for i := 0; i < 9; i++ {
+		require.NoError(t, limiter.wait(entities.PriorityBackfill, 1))
+	}
+	assert.ErrorIs(t, limiter.wait(entities.PriorityBackfill, 1), errQuotaExceeded, "backfill may only use 90% of the quota")
+	assert.NoError(t, limiter.wait(entities.PriorityTip, 1), "the rest of the quota is kept for the tip")
+	assert.ErrorIs(t, limiter.wait(entities.PriorityTip, 1), errQuotaExceeded)
+
+	usage := limiter.usage()
+	assert.Equal(t, int64(10), usage.DailyUsed)
+	assert.Equal(t, float64(100), usage.QuotaUsedPercent)
+}
+
+func TestRateLimiterChargesEveryCallOfABatch(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter := newRateLimiter(RateLimit{RequestsPerSecond: 2, Burst: 4, DailyQuota: 10})
+	limiter.now = func() time.Time { return now }
+	var slept time.Duration
+	limiter.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	require.NoError(t, limiter.wait(entities.PriorityTip, 4))
+	assert.Zero(t, slept)
+	require.NoError(t, limiter.wait(entities.PriorityTip, 1))
+	assert.Equal(t, 500*time.Millisecond, slept, "the batch took every token of the burst")
+
+	assert.ErrorIs(t, limiter.wait(entities.PriorityTip, 6), errQuotaExceeded, "the quota cannot cover the whole batch")
+	require.NoError(t, limiter.wait(entities.PriorityTip, 5))
+	usage := limiter.usage()
+	assert.Equal(t, int64(10), usage.DailyUsed)
+	assert.Equal(t, float64(100), usage.QuotaUsedPercent)
+}
+
+func TestRateLimiterTipBeatsBackfill(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RequestsPerSecond: 1000, Burst: 1})
+
+	// Simulate a tip call waiting for a token
+	limiter.mu.Lock()
+	limiter.waitingTip = 1
+	limiter.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		limiter.wait(entities.PriorityBackfill, 1)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("backfill should wait while a tip call is queued")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	limiter.mu.Lock()
+	limiter.waitingTip = 0
+	limiter.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("backfill should proceed once no tip call is queued")
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync/atomic"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// rpcReceipt mirrors the receipt objects returned by eth_getBlockReceipts and eth_getTransactionReceipt.
+type rpcReceipt struct {
+	TransactionHash   string  `json:"transactionHash"`
+	BlockHash         string  `json:"blockHash"`
+	Status            string  `json:"status"`
+	GasUsed           string  `json:"gasUsed"`
+	EffectiveGasPrice string  `json:"effectiveGasPrice"`
+	BlobGasUsed       string  `json:"blobGasUsed"`
+	BlobGasPrice      string  `json:"blobGasPrice"`
+	ContractAddress   *string `json:"contractAddress"`
+}
+
+func (r rpcReceipt) decode() (entities.Receipt, error) {
+	receipt := entities.Receipt{TransactionHash: r.TransactionHash, BlockHash: r.BlockHash}
+	switch r.Status {
+	case "0x1":
+		receipt.Status = entities.ExecutionStatusSuccess
+	case "0x0":
+		receipt.Status = entities.ExecutionStatusFailed
+	case "":
+		// Receipts older than Byzantium carry a state root instead of a status
+	default:
+		return entities.Receipt{}, fmt.Errorf("invalid status %q", r.Status)
+	}
+	if r.ContractAddress != nil {
+		receipt.ContractAddress = *r.ContractAddress
+	}
+
+	var err error
+	if receipt.GasUsed, err = decodeQuantity("gasUsed", r.GasUsed); err != nil {
+		return entities.Receipt{}, err
+	}
+	if receipt.EffectiveGasPrice, err = decodeBigQuantity("effectiveGasPrice", r.EffectiveGasPrice); err != nil {
+		return entities.Receipt{}, err
+	}
+	if receipt.BlobGasUsed, err = decodeQuantity("blobGasUsed", r.BlobGasUsed); err != nil {
+		return entities.Receipt{}, err
+	}
+	if receipt.BlobGasPrice, err = decodeBigQuantity("blobGasPrice", r.BlobGasPrice); err != nil {
+		return entities.Receipt{}, err
+	}
+	return receipt, nil
+}
+
+// GetReceipts fetches the receipts of transactions, keyed by lower-cased hash. It asks for whole blocks
+// with eth_getBlockReceipts and switches to one eth_getTransactionReceipt per transaction for good once
+// a provider does not know that method. Either way all calls go in a single batch.
+func (rpc *EthereumRPC) GetReceipts(transactions []entities.Transaction, priority entities.Priority) (map[string]entities.Receipt, error) {
+	if len(transactions) == 0 {
+		return map[string]entities.Receipt{}, nil
+	}
+	if atomic.LoadInt32(&rpc.blockReceiptsUnsupported) == 0 {
+		receipts, err := rpc.getBlockReceipts(transactions, priority)
+		if !isMethodNotFound(err) {
+			return receipts, err
+		}
+		atomic.StoreInt32(&rpc.blockReceiptsUnsupported, 1)
+		fmt.Println("eth_getBlockReceipts is not supported, falling back to eth_getTransactionReceipt")
+	}
+	return rpc.getTransactionReceipts(transactions, priority)
+}
+
+func (rpc *EthereumRPC) getBlockReceipts(transactions []entities.Transaction, priority entities.Priority) (map[string]entities.Receipt, error) {
+	var blockNumbers []int64
+	seen := make(map[int64]bool)
+	for _, tx := range transactions {
+		if !seen[tx.BlockNumber] {
+			seen[tx.BlockNumber] = true
+			blockNumbers = append(blockNumbers, tx.BlockNumber)
+		}
+	}
+
+	calls := make([]entities.RPCCall, len(blockNumbers))
+	for i, blockNumber := range blockNumbers {
+		calls[i] = entities.RPCCall{Method: "eth_getBlockReceipts", Params: []interface{}{fmt.Sprintf("0x%x", blockNumber)}}
+	}
+	results, err := rpc.Methods.MakeBatchRPCRequest(calls, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := make(map[string]entities.Receipt)
+	for i, result := range results {
+		if result.Error != nil {
+			return nil, fmt.Errorf("receipts of block %d: %w", blockNumbers[i], result.Error)
+		}
+		var blockReceipts []rpcReceipt
+		if err := json.Unmarshal(result.Result, &blockReceipts); err != nil {
+			return nil, fmt.Errorf("failed to decode receipts of block %d: %v", blockNumbers[i], err)
+		}
+		for _, r := range blockReceipts {
+			receipt, err := r.decode()
+			if err != nil {
+				return nil, fmt.Errorf("receipt of %s: %v", r.TransactionHash, err)
+			}
+			receipts[strings.ToLower(r.TransactionHash)] = receipt
+		}
+	}
+	return receipts, nil
+}
+
+func (rpc *EthereumRPC) getTransactionReceipts(transactions []entities.Transaction, priority entities.Priority) (map[string]entities.Receipt, error) {
+	calls := make([]entities.RPCCall, len(transactions))
+	for i, tx := range transactions {
+		calls[i] = entities.RPCCall{Method: "eth_getTransactionReceipt", Params: []interface{}{tx.Hash}}
+	}
+	results, err := rpc.Methods.MakeBatchRPCRequest(calls, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := make(map[string]entities.Receipt)
+	for i, result := range results {
+		hash := transactions[i].Hash
+		if result.Error != nil {
+			return nil, fmt.Errorf("receipt of %s: %w", hash, result.Error)
+		}
+		var r *rpcReceipt
+		if err := json.Unmarshal(result.Result, &r); err != nil {
+			return nil, fmt.Errorf("failed to decode receipt of %s: %v", hash, err)
+		}
+		if r == nil {
+			// The provider answering may not have seen the block yet
+			continue
+		}
+		receipt, err := r.decode()
+		if err != nil {
+			return nil, fmt.Errorf("receipt of %s: %v", hash, err)
+		}
+		receipts[strings.ToLower(hash)] = receipt
+	}
+	return receipts, nil
+}
+
+// isMethodNotFound reports whether err comes from a provider that does not implement the method called.
+func isMethodNotFound(err error) bool {
+	var rpcErr *entities.RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	message := strings.ToLower(rpcErr.Message)
+	return rpcErr.Code == -32601 || strings.Contains(message, "not supported") ||
+		strings.Contains(message, "does not exist") || strings.Contains(message, "not available")
+}
+
+// attachReceipts completes the matched transactions of a block with their receipts. It fails when a
+// receipt is missing or belongs to another block, so the block is matched again on the next tick.
+func (rpc *EthereumRPC) attachReceipts(matches map[string][]entities.Transaction, priority entities.Priority) error {
+	var unique []entities.Transaction
+	seen := make(map[string]bool)
+	for _, transactions := range matches {
+		for _, tx := range transactions {
+			if !seen[tx.Hash] {
+				seen[tx.Hash] = true
+				unique = append(unique, tx)
+			}
+		}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+
+	receipts, err := rpc.Methods.GetReceipts(unique, priority)
+	if err != nil {
+		return err
+	}
+	for _, transactions := range matches {
+		for i, tx := range transactions {
+			receipt, found := receipts[strings.ToLower(tx.Hash)]
+			if !found {
+				return fmt.Errorf("receipt of %s is not available yet", tx.Hash)
+			}
+			if receipt.BlockHash != "" && tx.BlockHash != "" && !strings.EqualFold(receipt.BlockHash, tx.BlockHash) {
+				return fmt.Errorf("receipt of %s belongs to block %s instead of %s", tx.Hash, receipt.BlockHash, tx.BlockHash)
+			}
+			transactions[i] = withReceipt(tx, receipt)
+		}
+	}
+	return nil
+}
+
+// withReceipt returns tx completed with receipt. Nodes from before London do not report the effective
+// gas price, which then is the gas price of the transaction.
+func withReceipt(tx entities.Transaction, receipt entities.Receipt) entities.Transaction {
+	tx.ExecutionStatus = receipt.Status
+	tx.GasUsed = receipt.GasUsed
+	tx.EffectiveGasPrice = receipt.EffectiveGasPrice
+	if tx.EffectiveGasPrice == "" {
+		tx.EffectiveGasPrice = tx.GasPrice
+	}
+	tx.ContractAddress = receipt.ContractAddress
+
+	fee := new(big.Int)
+	if price, ok := new(big.Int).SetString(tx.EffectiveGasPrice, 10); ok {
+		fee.Mul(price, new(big.Int).SetUint64(receipt.GasUsed))
+	}
+	if price, ok := new(big.Int).SetString(receipt.BlobGasPrice, 10); ok {
+		fee.Add(fee, price.Mul(price, new(big.Int).SetUint64(receipt.BlobGasUsed)))
+	}
+	tx.Fee = fee.String()
+	return tx
+}
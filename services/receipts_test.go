@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetReceiptsFallsBackToTransactionReceipts(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service := EthereumRPC{Methods: mockClient}
+	transactions := []entities.Transaction{
+		{Hash: "0xAA", BlockNumber: 5},
+		{Hash: "0xbb", BlockNumber: 5},
+	}
+
+	mockClient.On("MakeBatchRPCRequest", []entities.RPCCall{
+		{Method: "eth_getBlockReceipts", Params: []interface{}{"0x5"}},
+	}, entities.PriorityTip).Return([]entities.RPCResult{
+		{Error: &entities.RPCError{Code: -32601, Message: "the method eth_getBlockReceipts does not exist/is not available"}},
+	}, nil).Once()
+	mockClient.On("MakeBatchRPCRequest", []entities.RPCCall{
+		{Method: "eth_getTransactionReceipt", Params: []interface{}{"0xAA"}},
+		{Method: "eth_getTransactionReceipt", Params: []interface{}{"0xbb"}},
+	}, entities.PriorityTip).Return([]entities.RPCResult{
+		{Result: []byte(`{"transactionHash":"0xaa","blockHash":"b5","status":"0x0","gasUsed":"0x5208","effectiveGasPrice":"0x3b9aca00","contractAddress":null}`)},
+		{Result: []byte(`null`)},
+	}, nil)
+
+	receipts, err := service.GetReceipts(transactions, entities.PriorityTip)
+	assert.NoError(t, err)
+	assert.Equal(t, entities.Receipt{
+		TransactionHash:   "0xaa",
+		BlockHash:         "b5",
+		Status:            entities.ExecutionStatusFailed,
+		GasUsed:           21000,
+		EffectiveGasPrice: "1000000000",
+	}, receipts["0xaa"])
+	assert.NotContains(t, receipts, "0xbb", "receipts the node does not know yet are left out")
+
+	// The unsupported method is not tried again
+	_, err = service.GetReceipts(transactions, entities.PriorityTip)
+	assert.NoError(t, err)
+	mockClient.AssertNumberOfCalls(t, "MakeBatchRPCRequest", 3)
+}
+
+func TestWithReceiptComputesFee(t *testing.T) {
+	tx := entities.Transaction{Hash: "h1", GasPrice: "30000000000"}
+
+	legacy := withReceipt(tx, entities.Receipt{Status: entities.ExecutionStatusSuccess, GasUsed: 21000})
+	assert.Equal(t, "30000000000", legacy.EffectiveGasPrice, "nodes without effectiveGasPrice charge the gas price")
+	assert.Equal(t, "630000000000000", legacy.Fee)
+
+	blob := withReceipt(tx, entities.Receipt{
+		Status:            entities.ExecutionStatusSuccess,
+		GasUsed:           21000,
+		EffectiveGasPrice: "1000000000",
+		BlobGasUsed:       131072,
+		BlobGasPrice:      "2",
+		ContractAddress:   "0xc0de",
+	})
+	assert.Equal(t, "21000000262144", blob.Fee, "blob gas is paid on top of execution gas")
+	assert.Equal(t, "0xc0de", blob.ContractAddress)
+}
+
+func TestProcessNewBlocksWaitsForReceipts(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save("0x123", int64(100))
+	transactions := storages.NewTransactionStorage()
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	mockClient.On("GetInternalTransfers", mock.Anything, entities.PriorityTip).Return(nil, nil)
+	mockClient.On("GetLogs", int64(101), int64(101), mock.Anything, entities.PriorityTip).Return([]entities.Log{}, nil)
+	mockClient.On("GetBlockByNumber", int64(101)).Return(&entities.Block{
+		Number: 101, Hash: "a101", ParentHash: "a100",
+		Transactions: []entities.Transaction{{From: "0x123", To: "0x456", Hash: "h1", BlockNumber: 101, BlockHash: "a101"}},
+	}, nil)
+	mockClient.On("GetReceipts", mock.Anything, entities.PriorityTip).Return(nil, errors.New("receipt of h1: header not found")).Once()
+
+	service.processBlocksUpTo(101)
+	lastCheckedBlock, _, _ := subscriptions.Find("0x123")
+	assert.Equal(t, int64(100), lastCheckedBlock, "a block is not passed before its receipts are known")
+	stored, _, _ := transactions.Find("0x123")
+	assert.Empty(t, stored)
+
+	mockClient.On("GetReceipts", mock.Anything, entities.PriorityTip).Return(map[string]entities.Receipt{
+		"h1": {TransactionHash: "h1", BlockHash: "a101", Status: entities.ExecutionStatusFailed, GasUsed: 21000, EffectiveGasPrice: "2"},
+	}, nil)
+
+	service.processBlocksUpTo(101)
+	stored, _, _ = transactions.Find("0x123")
+	assert.Len(t, stored, 1)
+	assert.Equal(t, entities.ExecutionStatusFailed, stored[0].ExecutionStatus)
+	assert.Equal(t, "42000", stored[0].Fee)
+}
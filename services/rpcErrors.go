@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ErrorKind classifies why an outbound RPC call failed.
+type ErrorKind string
+
+const (
+	ErrorKindTransport   ErrorKind = "transport"
+	ErrorKindHTTPStatus  ErrorKind = "http_status"
+	ErrorKindRateLimit   ErrorKind = "rate_limit"
+	ErrorKindRPC         ErrorKind = "rpc"
+	ErrorKindCircuitOpen ErrorKind = "circuit_open"
+	// ErrorKindQuotaExceeded is not retryable since the quota only resets the next day.
+	ErrorKindQuotaExceeded ErrorKind = "quota_exceeded"
+)
+
+const (
+	rpcCodeInternalError = -32603
+	rpcCodeLimitExceeded = -32005
+)
+
+// RequestError is a classified failure of an outbound RPC call.
+type RequestError struct {
+	Kind       ErrorKind
+	Provider   string
+	StatusCode int
+	Code       int
+	Err        error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s error from %s: %v", e.Kind, e.Provider, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether sending the same call again later may succeed.
+func (e *RequestError) Retryable() bool {
+	switch e.Kind {
+	case ErrorKindTransport, ErrorKindRateLimit, ErrorKindCircuitOpen:
+		return true
+	case ErrorKindHTTPStatus:
+		return e.StatusCode >= 500
+	case ErrorKindRPC:
+		return e.Code == rpcCodeInternalError
+	}
+	return false
+}
+
+// IsRetryable reports whether err is a RequestError worth retrying.
+func IsRetryable(err error) bool {
+	var requestErr *RequestError
+	return errors.As(err, &requestErr) && requestErr.Retryable()
+}
+
+// RetryPolicy configures the exponential backoff applied between attempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// backoff returns a random delay up to BaseDelay*2^attempt, capped at MaxDelay (full jitter).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
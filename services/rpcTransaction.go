@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// rpcTransaction mirrors the transaction objects returned by eth_getBlockByNumber.
+type rpcTransaction struct {
+	From                 string  `json:"from"`
+	To                   *string `json:"to"`
+	Value                string  `json:"value"`
+	Hash                 string  `json:"hash"`
+	TransactionIndex     string  `json:"transactionIndex"`
+	Nonce                string  `json:"nonce"`
+	Gas                  string  `json:"gas"`
+	GasPrice             string  `json:"gasPrice"`
+	MaxFeePerGas         string  `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string  `json:"maxPriorityFeePerGas"`
+	Type                 string  `json:"type"`
+	ChainID              string  `json:"chainId"`
+	Input                string  `json:"input"`
+}
+
+// decode converts tx to a Transaction of block. Quantities missing from the node's answer are left zero.
+func (tx rpcTransaction) decode(block *entities.Block) (entities.Transaction, error) {
+	transaction := entities.Transaction{
+		From:        tx.From,
+		Kind:        entities.TransactionKindNative,
+		Value:       tx.Value,
+		Hash:        tx.Hash,
+		BlockNumber: block.Number,
+		BlockHash:   block.Hash,
+		Timestamp:   block.Timestamp,
+		Input:       tx.Input,
+	}
+	if tx.To != nil {
+		transaction.To = *tx.To
+	} else {
+		// Only a transaction deploying a contract has a null recipient
+		transaction.ContractCreation = true
+	}
+
+	var err error
+	if transaction.ValueWei, err = decodeBigQuantity("value", tx.Value); err != nil {
+		return entities.Transaction{}, err
+	}
+	if transaction.GasPrice, err = decodeBigQuantity("gasPrice", tx.GasPrice); err != nil {
+		return entities.Transaction{}, err
+	}
+	if transaction.MaxFeePerGas, err = decodeBigQuantity("maxFeePerGas", tx.MaxFeePerGas); err != nil {
+		return entities.Transaction{}, err
+	}
+	if transaction.MaxPriorityFeePerGas, err = decodeBigQuantity("maxPriorityFeePerGas", tx.MaxPriorityFeePerGas); err != nil {
+		return entities.Transaction{}, err
+	}
+
+	index, err := decodeQuantity("transactionIndex", tx.TransactionIndex)
+	if err != nil {
+		return entities.Transaction{}, err
+	}
+	transaction.TransactionIndex = int64(index)
+	if transaction.Nonce, err = decodeQuantity("nonce", tx.Nonce); err != nil {
+		return entities.Transaction{}, err
+	}
+	if transaction.Gas, err = decodeQuantity("gas", tx.Gas); err != nil {
+		return entities.Transaction{}, err
+	}
+	if transaction.Type, err = decodeQuantity("type", tx.Type); err != nil {
+		return entities.Transaction{}, err
+	}
+	if transaction.ChainID, err = decodeQuantity("chainId", tx.ChainID); err != nil {
+		return entities.Transaction{}, err
+	}
+
+	return transaction, nil
+}
+
+// decodeQuantity parses a hex quantity such as "0x1a", an empty value gives 0.
+func decodeQuantity(field string, value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	quantity, err := strconv.ParseUint(value, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", field, value)
+	}
+	return quantity, nil
+}
+
+// decodeBigQuantity converts a hex quantity of any size to a decimal string, an empty value stays empty.
+func decodeBigQuantity(field string, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	quantity, ok := new(big.Int).SetString(value, 0)
+	if !ok || quantity.Sign() < 0 {
+		return "", fmt.Errorf("invalid %s %q", field, value)
+	}
+	return quantity.String(), nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// storeTransactions assigns the next sequences of address to transactions and appends them.
+// Sequences are reserved before the append, so a crash in between leaves a gap but never reuses one.
+// The watcher and the backfills store concurrently, the lock of the address keeps its transactions in
+// sequence order.
+func (rpc *EthereumRPC) storeTransactions(address string, transactions []entities.Transaction) error {
+	// Skip addresses unsubscribed while their block was processed
+	_, subscribed, err := rpc.Storage.Subscriptions.Find(address)
+	if err != nil || !subscribed {
+		return err
+	}
+
+	lock := rpc.appendLock(address)
+	lock.Lock()
+	defer lock.Unlock()
+	first, err := rpc.reserveSequences(address, len(transactions))
+	if err != nil {
+		return err
+	}
+	for i := range transactions {
+		transactions[i].Sequence = first + uint64(i)
+	}
+	return rpc.Storage.Transactions.Append(address, transactions)
+}
+
+// appendLock returns the lock serializing the appends of address, shared with the addresses of the
+// same stripe.
+func (rpc *EthereumRPC) appendLock(address string) *sync.Mutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(address))
+	return &rpc.appendLocks[hash.Sum32()%uint32(len(rpc.appendLocks))]
+}
+
+// reserveSequences advances the last sequence of address by count and returns the first one reserved.
+func (rpc *EthereumRPC) reserveSequences(address string, count int) (uint64, error) {
+	var first uint64
+	err := rpc.updateStream(address, true, func(stream *entities.Stream) error {
+		first = stream.LastSequence + 1
+		stream.LastSequence += uint64(count)
+		return nil
+	})
+	return first, err
+}
+
+// updateStream applies fn to a copy of the stream of address and stores it unless fn fails, retrying
+// when the stream changed concurrently. Missing streams are created without consumers when create is
+// set, Subscribe creates them before the watcher sees the address so only older ones lack consumers.
+func (rpc *EthereumRPC) updateStream(address string, create bool, fn func(stream *entities.Stream) error) error {
+	for {
+		stream, exists, err := rpc.Storage.Streams.Find(address)
+		if err != nil {
+			return err
+		}
+		if !exists && !create {
+			return fmt.Errorf("%w: %s", entities.ErrStreamNotFound, address)
+		}
+
+		next := entities.Stream{Consumers: map[string]uint64{}}
+		if exists {
+			next = entities.Stream{LastSequence: stream.LastSequence, Consumers: consumerCursors(stream)}
+		}
+		if err := fn(&next); err != nil {
+			return err
+		}
+
+		if !exists {
+			created, err := rpc.createStream(address, next)
+			if err != nil || created {
+				return err
+			}
+			continue
+		}
+
+		swapped, err := rpc.Storage.Streams.CompareAndSwap(address, stream, next)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+	}
+}
+
+// createStream saves stream unless another one was created for address in the meantime.
+func (rpc *EthereumRPC) createStream(address string, stream entities.Stream) (bool, error) {
+	rpc.streamMu.Lock()
+	defer rpc.streamMu.Unlock()
+
+	_, exists, err := rpc.Storage.Streams.Find(address)
+	if err != nil || exists {
+		return false, err
+	}
+	return true, rpc.Storage.Streams.Save(address, stream)
+}
+
+// consumerCursors returns a copy of the consumers of stream, which is DefaultConsumer alone for
+// streams without any.
+func consumerCursors(stream entities.Stream) map[string]uint64 {
+	if len(stream.Consumers) == 0 {
+		return map[string]uint64{entities.DefaultConsumer: 0}
+	}
+	consumers := make(map[string]uint64, len(stream.Consumers))
+	for consumer, acknowledged := range stream.Consumers {
+		consumers[consumer] = acknowledged
+	}
+	return consumers
+}
+
+// acknowledgedRange returns the lowest and highest sequences acknowledged by the consumers of address.
+// Transactions up to the lowest are removed, and those up to the highest were seen by some consumer.
+func (rpc *EthereumRPC) acknowledgedRange(address string) (lowest uint64, highest uint64, err error) {
+	stream, _, err := rpc.Storage.Streams.Find(address)
+	if err != nil {
+		return 0, 0, err
+	}
+	lowest, highest = acknowledgedBounds(consumerCursors(stream))
+	return lowest, highest, nil
+}
+
+func acknowledgedBounds(consumers map[string]uint64) (lowest uint64, highest uint64) {
+	first := true
+	for _, acknowledged := range consumers {
+		if first || acknowledged < lowest {
+			lowest = acknowledged
+		}
+		if acknowledged > highest {
+			highest = acknowledged
+		}
+		first = false
+	}
+	return lowest, highest
+}
+
+// consumerCursor returns the sequence acknowledged by consumer on address.
+func (rpc *EthereumRPC) consumerCursor(address string, consumer string) (uint64, error) {
+	stream, _, err := rpc.Storage.Streams.Find(address)
+	if err != nil {
+		return 0, err
+	}
+	acknowledged, exists := consumerCursors(stream)[consumer]
+	if !exists {
+		return 0, fmt.Errorf("%w: %q on %s", entities.ErrConsumerNotFound, consumer, address)
+	}
+	return acknowledged, nil
+}
+
+// addConsumer registers consumer on address, starting from the oldest transaction still stored so it
+// receives everything the other consumers did not acknowledge yet. It reports whether it is new.
+func (rpc *EthereumRPC) addConsumer(address string, consumer string) (bool, error) {
+	added := false
+	err := rpc.updateStream(address, true, func(stream *entities.Stream) error {
+		added = false
+		if _, exists := stream.Consumers[consumer]; exists {
+			return nil
+		}
+		lowest, _ := acknowledgedBounds(stream.Consumers)
+		stream.Consumers[consumer] = lowest
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+// AcknowledgeTransactions confirms consumer received the transactions of address up to sequence.
+// They are removed from storage once every consumer of address acknowledged them. Acknowledging an
+// older sequence again has no effect.
+func (rpc *EthereumRPC) AcknowledgeTransactions(address string, consumer string, sequence uint64) error {
+	var retained uint64
+	err := rpc.updateStream(address, false, func(stream *entities.Stream) error {
+		acknowledged, exists := stream.Consumers[consumer]
+		if !exists {
+			return fmt.Errorf("%w: %q on %s", entities.ErrConsumerNotFound, consumer, address)
+		}
+		if sequence > stream.LastSequence {
+			return fmt.Errorf("%w: %d is after the last sequence %d", entities.ErrSequenceNotAssigned, sequence, stream.LastSequence)
+		}
+		if sequence > acknowledged {
+			stream.Consumers[consumer] = sequence
+		}
+		retained, _ = acknowledgedBounds(stream.Consumers)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The cursors are stored first so the sequences removed here are never assigned again
+	_, err = rpc.removeTransactions(address, func(tx entities.Transaction) bool {
+		return tx.Sequence <= retained
+	})
+	return err
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// subscribe registers consumer on address, subscribing the address from startBlock when it is new.
+// It reports whether either of them is new.
+func (rpc *EthereumRPC) subscribe(address string, consumer string, startBlock int64) (bool, error) {
+	if address == "" {
+		return false, errors.New("address is required")
+	}
+	if startBlock < 0 {
+		return false, errors.New("failed to fetch the current block")
+	}
+	_, exists, err := rpc.Storage.Subscriptions.Find(address)
+	if err != nil {
+		return false, err
+	}
+	if !exists && rpc.MaxSubscriptions > 0 {
+		count, err := rpc.countSubscriptions()
+		if err != nil {
+			return false, err
+		}
+		if count >= rpc.MaxSubscriptions {
+			return false, fmt.Errorf("%w: %d", entities.ErrTooManySubscriptions, rpc.MaxSubscriptions)
+		}
+	}
+
+	// The consumer is registered first so the watcher never stores transactions nobody can read
+	added, err := rpc.addConsumer(address, consumer)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		if err := rpc.Storage.Subscriptions.Save(address, startBlock); err != nil {
+			return false, err
+		}
+	}
+	if !exists || added {
+		event := entities.SubscriptionAdded{Address: address, Consumer: consumer, StartBlock: startBlock}
+		if err := rpc.Events().Publish(event); err != nil {
+			return false, err
+		}
+	}
+	return !exists || added, nil
+}
+
+// countSubscriptions returns the number of subscribed addresses, without copying them when the storage
+// can count.
+func (rpc *EthereumRPC) countSubscriptions() (int, error) {
+	if counter, ok := rpc.Storage.Subscriptions.(interface{ Len() int }); ok {
+		return counter.Len(), nil
+	}
+	all, err := rpc.Storage.Subscriptions.GetAll()
+	return len(all), err
+}
+
+// Unsubscribe removes address along with all its consumers and stored transactions.
+func (rpc *EthereumRPC) Unsubscribe(address string) bool {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+	removed, err := rpc.unsubscribe(address)
+	if err != nil {
+		fmt.Printf("Error unsubscribing %s: %v\n", address, err)
+		return false
+	}
+	return removed
+}
+
+// UnsubscribeConsumer removes consumer from address, and the address itself along with its last consumer.
+func (rpc *EthereumRPC) UnsubscribeConsumer(address string, consumer string) bool {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+	removed, err := rpc.unsubscribeConsumer(address, consumer)
+	if err != nil {
+		fmt.Printf("Error unsubscribing %q from %s: %v\n", consumer, address, err)
+		return false
+	}
+	return removed
+}
+
+func (rpc *EthereumRPC) unsubscribe(address string) (bool, error) {
+	_, exists, err := rpc.Storage.Subscriptions.Find(address)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	// The subscription goes first so the watcher stops storing transactions for the address
+	if err := rpc.Storage.Subscriptions.Delete(address); err != nil {
+		return false, err
+	}
+	if err := rpc.Storage.Streams.Delete(address); err != nil {
+		return false, err
+	}
+	if err := rpc.Storage.Transactions.Delete(address); err != nil {
+		return false, err
+	}
+	if err := rpc.Storage.Backfills.Delete(address); err != nil {
+		return false, err
+	}
+	if err := rpc.removeWebhooks(address); err != nil {
+		return false, err
+	}
+	if err := rpc.Storage.Devices.Delete(address); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (rpc *EthereumRPC) unsubscribeConsumer(address string, consumer string) (bool, error) {
+	last := false
+	var retained uint64
+	err := rpc.updateStream(address, false, func(stream *entities.Stream) error {
+		if _, exists := stream.Consumers[consumer]; !exists {
+			return entities.ErrConsumerNotFound
+		}
+		last = len(stream.Consumers) == 1
+		delete(stream.Consumers, consumer)
+		retained, _ = acknowledgedBounds(stream.Consumers)
+		return nil
+	})
+	if errors.Is(err, entities.ErrConsumerNotFound) || errors.Is(err, entities.ErrStreamNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if last {
+		if _, err := rpc.unsubscribe(address); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if _, err := rpc.RemoveWebhook(address, consumer); err != nil {
+		return false, err
+	}
+
+	// The remaining consumers may all have acknowledged more than the removed one
+	_, err = rpc.removeTransactions(address, func(tx entities.Transaction) bool {
+		return tx.Sequence <= retained
+	})
+	return true, err
+}
+
+// SubscribeAll applies every change with Subscribe semantics, looking up the current block only once.
+func (rpc *EthereumRPC) SubscribeAll(changes []entities.SubscriptionChange) []entities.SubscriptionChangeResult {
+	startBlock := rpc.currentHead()
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+
+	results := make([]entities.SubscriptionChangeResult, len(changes))
+	for i, change := range changes {
+		results[i].SubscriptionChange = change
+		changed, err := rpc.subscribe(change.Address, change.Consumer, startBlock)
+		results[i].Changed = changed
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// UnsubscribeAll removes the consumer of every change, or the whole address when it names none.
+func (rpc *EthereumRPC) UnsubscribeAll(changes []entities.SubscriptionChange) []entities.SubscriptionChangeResult {
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+
+	results := make([]entities.SubscriptionChangeResult, len(changes))
+	for i, change := range changes {
+		results[i].SubscriptionChange = change
+		var changed bool
+		var err error
+		if change.Consumer == "" {
+			changed, err = rpc.unsubscribe(change.Address)
+		} else {
+			changed, err = rpc.unsubscribeConsumer(change.Address, change.Consumer)
+		}
+		results[i].Changed = changed
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// GetSubscriptions lists every subscribed address ordered by address.
+func (rpc *EthereumRPC) GetSubscriptions() ([]entities.Subscription, error) {
+	all, err := rpc.Storage.Subscriptions.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	currentBlock := int64(rpc.Methods.GetCurrentBlock())
+	if currentBlock < 0 {
+		return nil, fmt.Errorf("failed to fetch the current block")
+	}
+
+	subscriptions := make([]entities.Subscription, 0, len(all))
+	for address, lastCheckedBlock := range all {
+		subscription, err := rpc.describeSubscription(address, lastCheckedBlock, currentBlock)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Address < subscriptions[j].Address
+	})
+	return subscriptions, nil
+}
+
+func (rpc *EthereumRPC) GetSubscription(address string) (*entities.Subscription, error) {
+	lastCheckedBlock, exists, err := rpc.Storage.Subscriptions.Find(address)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", entities.ErrSubscriptionNotFound, address)
+	}
+	currentBlock := int64(rpc.Methods.GetCurrentBlock())
+	if currentBlock < 0 {
+		return nil, fmt.Errorf("failed to fetch the current block")
+	}
+
+	subscription, err := rpc.describeSubscription(address, lastCheckedBlock, currentBlock)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (rpc *EthereumRPC) describeSubscription(address string, lastCheckedBlock int64, currentBlock int64) (entities.Subscription, error) {
+	stream, _, err := rpc.Storage.Streams.Find(address)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	subscription := entities.Subscription{
+		Address:          address,
+		LastCheckedBlock: lastCheckedBlock,
+		LastSequence:     stream.LastSequence,
+	}
+	if lastCheckedBlock < currentBlock {
+		subscription.Lag = currentBlock - lastCheckedBlock
+	}
+	backfill, exists, err := rpc.Storage.Backfills.Find(address)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+	if exists {
+		subscription.Backfill = &backfill
+	}
+	for name, acknowledged := range consumerCursors(stream) {
+		subscription.Consumers = append(subscription.Consumers, entities.ConsumerState{Name: name, Acknowledged: acknowledged})
+	}
+	sort.Slice(subscription.Consumers, func(i, j int) bool {
+		return subscription.Consumers[i].Name < subscription.Consumers[j].Name
+	})
+	return subscription, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSubscriptionService(mockClient *mocks.MockHTTPClient) (*EthereumRPC, *storages.MemoryStorage) {
+	storage := storages.NewMemoryStorage()
+	return &EthereumRPC{Storage: storage, Methods: mockClient}, storage
+}
+
+// subscribeConsumer subscribes consumer to address and reports whether either of them is new.
+func subscribeConsumer(t *testing.T, service *EthereumRPC, address string, consumer string) bool {
+	subscribed, err := service.SubscribeConsumer(address, consumer)
+	require.NoError(t, err)
+	return subscribed
+}
+
+func TestUnsubscribeRemovesAddress(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	mockClient.On("GetBlocksByNumber", []int64{101, 102}, entities.PriorityTip).Return([]*entities.Block{
+		{Number: 101, Transactions: []entities.Transaction{{From: "0x123", To: "0x456", Hash: "h1"}}},
+		{Number: 102, Transactions: []entities.Transaction{{From: "0x456", To: "0x123", Hash: "h2"}}},
+	}, nil)
+
+	require.True(t, service.Subscribe("0x123"))
+	service.processBlocksUpTo(102)
+
+	assert.True(t, service.Unsubscribe("0x123"))
+	assert.False(t, service.Unsubscribe("0x123"), "the address is no longer subscribed")
+
+	_, exists, _ := storage.Subscriptions.Find("0x123")
+	assert.False(t, exists)
+	_, exists, _ = storage.Streams.Find("0x123")
+	assert.False(t, exists)
+	_, exists, _ = storage.Transactions.Find("0x123")
+	assert.False(t, exists)
+
+	// A block matched before the unsubscribe must not bring the address back
+	assert.NoError(t, service.storeTransactions("0x123", []entities.Transaction{{Hash: "late"}}))
+	_, exists, _ = storage.Transactions.Find("0x123")
+	assert.False(t, exists)
+}
+
+func TestUnsubscribeConsumer(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockBlockDetails(mockClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	mockClient.On("GetBlocksByNumber", []int64{101, 102}, entities.PriorityTip).Return([]*entities.Block{
+		{Number: 101, Transactions: []entities.Transaction{{From: "0x123", To: "0x456", Hash: "h1"}}},
+		{Number: 102, Transactions: []entities.Transaction{{From: "0x456", To: "0x123", Hash: "h2"}}},
+	}, nil)
+
+	require.True(t, subscribeConsumer(t, service, "0x123", "mobile"))
+	require.True(t, subscribeConsumer(t, service, "0x123", "analytics"))
+	service.processBlocksUpTo(102)
+	require.NoError(t, service.AcknowledgeTransactions("0x123", "mobile", 2))
+
+	assert.False(t, service.UnsubscribeConsumer("0x123", "unknown"))
+	assert.True(t, service.UnsubscribeConsumer("0x123", "analytics"))
+	stored, _, _ := storage.Transactions.Find("0x123")
+	assert.Empty(t, stored, "the transactions only analytics was still waiting for are removed")
+
+	assert.True(t, service.UnsubscribeConsumer("0x123", "mobile"))
+	_, exists, _ := storage.Subscriptions.Find("0x123")
+	assert.False(t, exists, "the address goes away with its last consumer")
+}
+
+func TestSubscribeAllFetchesCurrentBlockOnce(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100).Once()
+
+	results := service.SubscribeAll([]entities.SubscriptionChange{
+		{Address: "0x123"},
+		{Address: "0x123", Consumer: "analytics"},
+		{Address: "0x123"},
+		{Address: ""},
+	})
+
+	assert.Equal(t, []bool{true, true, false, false}, changed(results))
+	assert.Equal(t, "address is required", results[3].Error)
+	mockClient.AssertNumberOfCalls(t, "GetCurrentBlock", 1)
+
+	lastCheckedBlock, _, _ := storage.Subscriptions.Find("0x123")
+	assert.Equal(t, int64(100), lastCheckedBlock)
+
+	results = service.UnsubscribeAll([]entities.SubscriptionChange{
+		{Address: "0x123", Consumer: "analytics"},
+		{Address: "0x123"},
+		{Address: "0x999"},
+	})
+	assert.Equal(t, []bool{true, true, false}, changed(results))
+}
+
+func TestGetSubscriptions(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service, storage := newSubscriptionService(mockClient)
+	mockClient.On("GetCurrentBlock").Return(100).Times(3)
+
+	require.True(t, subscribeConsumer(t, service, "0x456", "mobile"))
+	require.True(t, service.Subscribe("0x123"))
+	require.True(t, subscribeConsumer(t, service, "0x123", "analytics"))
+	storage.Subscriptions.Update("0x456", 90)
+
+	mockClient.On("GetCurrentBlock").Return(110)
+	subscriptions, err := service.GetSubscriptions()
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 2)
+	assert.Equal(t, "0x123", subscriptions[0].Address)
+	assert.Equal(t, int64(10), subscriptions[0].Lag)
+	assert.Equal(t, []entities.ConsumerState{{Name: ""}, {Name: "analytics"}}, subscriptions[0].Consumers)
+	assert.Equal(t, int64(20), subscriptions[1].Lag)
+
+	subscription, err := service.GetSubscription("0x456")
+	require.NoError(t, err)
+	assert.Equal(t, int64(90), subscription.LastCheckedBlock)
+	assert.Equal(t, []entities.ConsumerState{{Name: "mobile"}}, subscription.Consumers)
+
+	_, err = service.GetSubscription("0x999")
+	assert.ErrorIs(t, err, entities.ErrSubscriptionNotFound)
+}
+
+func changed(results []entities.SubscriptionChangeResult) []bool {
+	var result []bool
+	for _, r := range results {
+		result = append(result, r.Changed)
+	}
+	return result
+}
+
+func TestSubscribeAllRefusesAddressesBeyondTheLimit(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(100)
+	service := EthereumRPC{
+		Storage:          storages.NewMemoryStorage(),
+		Methods:          mockClient,
+		MaxSubscriptions: 2,
+	}
+
+	results := service.SubscribeAll([]entities.SubscriptionChange{
+		{Address: wallet, Consumer: "app"},
+		{Address: sender, Consumer: "app"},
+		{Address: router, Consumer: "app"},
+		{Address: wallet, Consumer: "web"},
+	})
+	assert.Empty(t, results[0].Error)
+	assert.Empty(t, results[1].Error)
+	assert.Contains(t, results[2].Error, entities.ErrTooManySubscriptions.Error())
+	assert.Empty(t, results[3].Error, "consumers of subscribed addresses do not count")
+
+	_, subscribed, _ := service.Storage.Subscriptions.Find(router)
+	assert.False(t, subscribed)
+}
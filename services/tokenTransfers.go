@@ -0,0 +1,257 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+// Keccak-256 hashes of the token transfer events. Transfer(address,address,uint256) is emitted by both
+// ERC-20 and ERC-721 contracts, TransferSingle and TransferBatch by ERC-1155 contracts.
+const (
+	transferTopic       = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	transferSingleTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	transferBatchTopic  = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+// rpcLog mirrors the log objects returned by eth_getLogs.
+type rpcLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockNumber     string   `json:"blockNumber"`
+	BlockHash       string   `json:"blockHash"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+}
+
+// GetLogs returns the logs emitted between fromBlock and toBlock whose topics match topics, where each
+// position lists the accepted values and a nil position accepts any.
+func (rpc *EthereumRPC) GetLogs(fromBlock int64, toBlock int64, topics [][]string, priority entities.Priority) ([]entities.Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": fmt.Sprintf("0x%x", fromBlock),
+		"toBlock":   fmt.Sprintf("0x%x", toBlock),
+		"topics":    topics,
+	}
+	results, err := rpc.Methods.MakeBatchRPCRequest([]entities.RPCCall{{Method: "eth_getLogs", Params: []interface{}{filter}}}, priority)
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Error != nil {
+		return nil, fmt.Errorf("logs of blocks %d to %d: %w", fromBlock, toBlock, results[0].Error)
+	}
+
+	var rpcLogs []rpcLog
+	if err := json.Unmarshal(results[0].Result, &rpcLogs); err != nil {
+		return nil, fmt.Errorf("failed to decode logs: %v", err)
+	}
+	logs := make([]entities.Log, 0, len(rpcLogs))
+	for _, l := range rpcLogs {
+		blockNumber, err := decodeQuantity("blockNumber", l.BlockNumber)
+		if err != nil {
+			return nil, err
+		}
+		logIndex, err := decodeQuantity("logIndex", l.LogIndex)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, entities.Log{
+			Address:         l.Address,
+			Topics:          l.Topics,
+			Data:            l.Data,
+			BlockNumber:     int64(blockNumber),
+			BlockHash:       l.BlockHash,
+			TransactionHash: l.TransactionHash,
+			LogIndex:        logIndex,
+		})
+	}
+	return logs, nil
+}
+
+// fetchTransferLogs returns the token transfer logs of blocks grouped by block number. It fails when a log
+// comes from another block than the one fetched, so the blocks are processed again on the next tick.
+func (rpc *EthereumRPC) fetchTransferLogs(blocks []*entities.Block, priority entities.Priority) (map[int64][]entities.Log, error) {
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	logs, err := rpc.Methods.GetLogs(blocks[0].Number, blocks[len(blocks)-1].Number, [][]string{{transferTopic, transferSingleTopic, transferBatchTopic}}, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[int64]string, len(blocks))
+	for _, block := range blocks {
+		hashes[block.Number] = block.Hash
+	}
+	byBlock := make(map[int64][]entities.Log)
+	for _, log := range logs {
+		if hash, fetched := hashes[log.BlockNumber]; fetched && hash != "" && log.BlockHash != "" && !strings.EqualFold(hash, log.BlockHash) {
+			return nil, fmt.Errorf("log %d of block %d belongs to block %s instead of %s", log.LogIndex, log.BlockNumber, log.BlockHash, hash)
+		}
+		byBlock[log.BlockNumber] = append(byBlock[log.BlockNumber], log)
+	}
+	return byBlock, nil
+}
+
+// decodeTokenTransfers reads the transfers reported by a log of a token contract, along with the kind of
+// token they move. Logs of other events, or too malformed to decode, give no transfers.
+func decodeTokenTransfers(log entities.Log) (string, []entities.TokenTransfer) {
+	if len(log.Topics) == 0 {
+		return "", nil
+	}
+	words, ok := dataWords(log.Data)
+	if !ok {
+		return "", nil
+	}
+
+	switch strings.ToLower(log.Topics[0]) {
+	case transferTopic:
+		// ERC-20 and ERC-721 share the event, only ERC-721 indexes its last argument, the token id
+		from, to, ok := topicAddresses(log.Topics, 1)
+		if !ok {
+			return "", nil
+		}
+		transfer := entities.TokenTransfer{Contract: log.Address, From: from, To: to, LogIndex: log.LogIndex}
+		switch {
+		case len(log.Topics) == 3 && len(words) == 1:
+			transfer.Amount = decodeWord(words[0])
+			return entities.TransactionKindERC20, []entities.TokenTransfer{transfer}
+		case len(log.Topics) == 4 && len(words) == 0:
+			transfer.TokenID = decodeWord(strings.TrimPrefix(log.Topics[3], "0x"))
+			transfer.Amount = "1"
+			return entities.TransactionKindERC721, []entities.TokenTransfer{transfer}
+		}
+
+	case transferSingleTopic:
+		operator, operatorOK := topicAddress(log.Topics[1])
+		from, to, ok := topicAddresses(log.Topics, 2)
+		if !operatorOK || !ok || len(log.Topics) != 4 || len(words) != 2 {
+			return "", nil
+		}
+		return entities.TransactionKindERC1155, []entities.TokenTransfer{{
+			Contract: log.Address,
+			Operator: operator,
+			From:     from,
+			To:       to,
+			TokenID:  decodeWord(words[0]),
+			Amount:   decodeWord(words[1]),
+			LogIndex: log.LogIndex,
+		}}
+
+	case transferBatchTopic:
+		operator, operatorOK := topicAddress(log.Topics[1])
+		from, to, ok := topicAddresses(log.Topics, 2)
+		if !operatorOK || !ok || len(log.Topics) != 4 || len(words) < 2 {
+			return "", nil
+		}
+		ids, idsOK := decodeWordArray(words, words[0])
+		amounts, amountsOK := decodeWordArray(words, words[1])
+		if !idsOK || !amountsOK || len(ids) != len(amounts) {
+			return "", nil
+		}
+		transfers := make([]entities.TokenTransfer, len(ids))
+		for i := range ids {
+			transfers[i] = entities.TokenTransfer{
+				Contract: log.Address,
+				Operator: operator,
+				From:     from,
+				To:       to,
+				TokenID:  ids[i],
+				Amount:   amounts[i],
+				LogIndex: log.LogIndex,
+			}
+		}
+		return entities.TransactionKindERC1155, transfers
+	}
+	return "", nil
+}
+
+// topicAddress extracts the address left-padded to 32 bytes in an indexed topic.
+func topicAddress(topic string) (string, bool) {
+	topic = strings.TrimPrefix(topic, "0x")
+	if len(topic) != 64 {
+		return "", false
+	}
+	return "0x" + strings.ToLower(topic[24:]), true
+}
+
+// topicAddresses extracts the sender and recipient indexed in the topics following position first.
+func topicAddresses(topics []string, first int) (string, string, bool) {
+	if len(topics) < first+2 {
+		return "", "", false
+	}
+	from, fromOK := topicAddress(topics[first])
+	to, toOK := topicAddress(topics[first+1])
+	return from, to, fromOK && toOK
+}
+
+// dataWords splits ABI encoded log data in its 32 byte words, as hex without prefix.
+func dataWords(data string) ([]string, bool) {
+	data = strings.TrimPrefix(data, "0x")
+	if len(data)%64 != 0 {
+		return nil, false
+	}
+	words := make([]string, len(data)/64)
+	for i := range words {
+		words[i] = data[i*64 : (i+1)*64]
+	}
+	for _, word := range words {
+		if _, ok := new(big.Int).SetString(word, 16); !ok {
+			return nil, false
+		}
+	}
+	return words, true
+}
+
+// decodeWord converts a word checked by dataWords to a decimal string.
+func decodeWord(word string) string {
+	value, ok := new(big.Int).SetString(word, 16)
+	if !ok {
+		return "0"
+	}
+	return value.String()
+}
+
+// decodeWordArray reads the uint256 array whose byte offset in the data is the word offset.
+func decodeWordArray(words []string, offset string) ([]string, bool) {
+	position, ok := new(big.Int).SetString(offset, 16)
+	if !ok || !position.IsInt64() || position.Int64()%32 != 0 {
+		return nil, false
+	}
+	start := position.Int64() / 32
+	if start >= int64(len(words)) {
+		return nil, false
+	}
+	length, ok := new(big.Int).SetString(words[start], 16)
+	if !ok || !length.IsInt64() || start+1+length.Int64() > int64(len(words)) {
+		return nil, false
+	}
+
+	values := make([]string, length.Int64())
+	for i := range values {
+		values[i] = decodeWord(words[start+1+int64(i)])
+	}
+	return values, true
+}
+
+// tokenTransaction returns the record of transfer, carried by the transaction of block with the log's hash.
+func tokenTransaction(block entities.Block, log entities.Log, kind string, transfer entities.TokenTransfer) entities.Transaction {
+	tx := entities.Transaction{
+		Hash:        log.TransactionHash,
+		BlockNumber: block.Number,
+		BlockHash:   block.Hash,
+		Timestamp:   block.Timestamp,
+	}
+	for _, candidate := range block.Transactions {
+		if strings.EqualFold(candidate.Hash, log.TransactionHash) {
+			tx = candidate
+			break
+		}
+	}
+	tx.Kind = kind
+	tx.Token = &transfer
+	return tx
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	wallet = "0x1111111111111111111111111111111111111111"
+	sender = "0x2222222222222222222222222222222222222222"
+	token  = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+)
+
+func addressTopic(address string) string {
+	return "0x000000000000000000000000" + address[2:]
+}
+
+func TestGetLogs(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	service := EthereumRPC{Methods: mockClient}
+
+	mockClient.On("MakeBatchRPCRequest", []entities.RPCCall{{Method: "eth_getLogs", Params: []interface{}{map[string]interface{}{
+		"fromBlock": "0x65",
+		"toBlock":   "0x66",
+		"topics":    [][]string{{transferTopic}},
+	}}}}, entities.PriorityTip).Return([]entities.RPCResult{
+		{Result: []byte(`[{"address":"0xc0de","topics":["0x1"],"data":"0x","blockNumber":"0x66","blockHash":"a102","transactionHash":"h1","logIndex":"0x7"}]`)},
+	}, nil)
+
+	logs, err := service.GetLogs(101, 102, [][]string{{transferTopic}}, entities.PriorityTip)
+	assert.NoError(t, err)
+	assert.Equal(t, []entities.Log{{
+		Address:         "0xc0de",
+		Topics:          []string{"0x1"},
+		Data:            "0x",
+		BlockNumber:     102,
+		BlockHash:       "a102",
+		TransactionHash: "h1",
+		LogIndex:        7,
+	}}, logs)
+}
+
+func TestProcessNewBlocksMatchesTokenTransfers(t *testing.T) {
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetReceipts", mock.Anything, entities.PriorityTip).Return(map[string]entities.Receipt{
+		"h1": {TransactionHash: "h1", BlockHash: "a101", Status: entities.ExecutionStatusSuccess, GasUsed: 46000, EffectiveGasPrice: "1"},
+	}, nil)
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	transactions := storages.NewTransactionStorage()
+
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, transactions),
+		Methods: mockClient,
+	}
+
+	// The transaction calls the token contract, only its log names the wallet
+	mockClient.On("GetBlockByNumber", int64(101)).Return(&entities.Block{
+		Number: 101, Hash: "a101", ParentHash: "a100",
+		Transactions: []entities.Transaction{{From: sender, To: token, Hash: "h1", BlockNumber: 101, BlockHash: "a101", Kind: entities.TransactionKindNative}},
+	}, nil)
+	mockClient.On("GetInternalTransfers", mock.Anything, entities.PriorityTip).Return(nil, nil)
+	mockClient.On("GetLogs", int64(101), int64(101), [][]string{{transferTopic, transferSingleTopic, transferBatchTopic}}, entities.PriorityTip).Return([]entities.Log{
+		{
+			Address:         token,
+			Topics:          []string{transferTopic, addressTopic(sender), addressTopic(wallet)},
+			Data:            "0x00000000000000000000000000000000000000000000000000000000000f4240",
+			BlockNumber:     101,
+			BlockHash:       "a101",
+			TransactionHash: "h1",
+			LogIndex:        3,
+		},
+		{
+			Address:         token,
+			Topics:          []string{transferTopic, addressTopic(sender), addressTopic(wallet), "0x0000000000000000000000000000000000000000000000000000000000000007"},
+			Data:            "0x",
+			BlockNumber:     101,
+			BlockHash:       "a101",
+			TransactionHash: "h1",
+			LogIndex:        4,
+		},
+	}, nil)
+
+	service.processBlocksUpTo(101)
+
+	stored, _, _ := transactions.Find(wallet)
+	assert.Len(t, stored, 2)
+	assert.Equal(t, entities.TransactionKindERC20, stored[0].Kind)
+	assert.Equal(t, &entities.TokenTransfer{Contract: token, From: sender, To: wallet, Amount: "1000000", LogIndex: 3}, stored[0].Token)
+	assert.Equal(t, sender, stored[0].From, "the record keeps the details of its transaction")
+	assert.Equal(t, "46000", stored[0].Fee)
+	// An ERC-721 transfer shares the event, but indexes its token id
+	assert.Equal(t, entities.TransactionKindERC721, stored[1].Kind)
+	assert.Equal(t, &entities.TokenTransfer{Contract: token, From: sender, To: wallet, TokenID: "7", Amount: "1", LogIndex: 4}, stored[1].Token)
+}
+
+func TestDecodeTokenTransfersOfERC1155(t *testing.T) {
+	word := func(value string) string {
+		return fmt.Sprintf("%064s", value)
+	}
+	topics := []string{"", addressTopic(sender), addressTopic(sender), addressTopic(wallet)}
+
+	topics[0] = transferSingleTopic
+	kind, transfers := decodeTokenTransfers(entities.Log{Address: token, Topics: topics, Data: "0x" + word("2a") + word("5"), LogIndex: 1})
+	assert.Equal(t, entities.TransactionKindERC1155, kind)
+	assert.Equal(t, []entities.TokenTransfer{{Contract: token, Operator: sender, From: sender, To: wallet, TokenID: "42", Amount: "5", LogIndex: 1}}, transfers)
+
+	// Two dynamic arrays: their offsets, then the length and items of each
+	topics[0] = transferBatchTopic
+	data := "0x" + word("40") + word("a0") + word("2") + word("1") + word("2") + word("2") + word("a") + word("14")
+	kind, transfers = decodeTokenTransfers(entities.Log{Address: token, Topics: topics, Data: data, LogIndex: 2})
+	assert.Equal(t, entities.TransactionKindERC1155, kind)
+	assert.Equal(t, []entities.TokenTransfer{
+		{Contract: token, Operator: sender, From: sender, To: wallet, TokenID: "1", Amount: "10", LogIndex: 2},
+		{Contract: token, Operator: sender, From: sender, To: wallet, TokenID: "2", Amount: "20", LogIndex: 2},
+	}, transfers)
+
+	_, transfers = decodeTokenTransfers(entities.Log{Address: token, Topics: topics, Data: "0x" + word("40") + word("a0") + word("9")})
+	assert.Empty(t, transfers, "arrays running past the data are malformed")
+}
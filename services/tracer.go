@@ -0,0 +1,260 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+)
+
+const (
+	// TracerCallTracer traces with debug_traceBlockByNumber and the callTracer, as geth does.
+	TracerCallTracer = "callTracer"
+	// TracerTraceBlock traces with trace_block, as Erigon and Nethermind do.
+	TracerTraceBlock = "trace_block"
+)
+
+// ParseTracer checks value names a supported tracing API.
+func ParseTracer(value string) (string, error) {
+	switch value {
+	case TracerCallTracer, TracerTraceBlock:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid tracer %q, expected %s or %s", value, TracerCallTracer, TracerTraceBlock)
+}
+
+// callFrame mirrors the frames returned by the callTracer, each holding the calls it made.
+type callFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Error string      `json:"error"`
+	Calls []callFrame `json:"calls"`
+}
+
+// parityTrace mirrors the flat traces returned by trace_block, where traceAddress locates the call in
+// the call tree of its transaction.
+type parityTrace struct {
+	Type   string `json:"type"`
+	Action struct {
+		CallType      string `json:"callType"`
+		From          string `json:"from"`
+		To            string `json:"to"`
+		Value         string `json:"value"`
+		Address       string `json:"address"`
+		RefundAddress string `json:"refundAddress"`
+		Balance       string `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		Address string `json:"address"`
+	} `json:"result"`
+	Error           string  `json:"error"`
+	TraceAddress    []int   `json:"traceAddress"`
+	BlockHash       string  `json:"blockHash"`
+	TransactionHash *string `json:"transactionHash"`
+}
+
+// GetInternalTransfers traces block on a provider able to, and returns the ether moved by contracts
+// keyed by lower-cased transaction hash. Without any such provider it returns none.
+func (rpc *EthereumRPC) GetInternalTransfers(block *entities.Block, priority entities.Priority) (map[string][]entities.InternalTransfer, error) {
+	if rpc.Providers == nil || !rpc.Providers.Tracing() {
+		return nil, nil
+	}
+
+	resp, tracer, err := rpc.Providers.DoTrace(func(tracer string) string {
+		if tracer == TracerTraceBlock {
+			return fmt.Sprintf(`{"jsonrpc":"2.0","method":"trace_block","params":["0x%x"],"id":1}`, block.Number)
+		}
+		return fmt.Sprintf(`{"jsonrpc":"2.0","method":"debug_traceBlockByNumber","params":["0x%x",{"tracer":"callTracer"}],"id":1}`, block.Number)
+	}, priority)
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Println("Error body read closer:", err)
+		}
+	}(resp.Body)
+
+	var rpcResult struct {
+		Result json.RawMessage    `json:"result"`
+		Error  *entities.RPCError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResult); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	if rpcResult.Error != nil {
+		return nil, fmt.Errorf("traces of block %d: %w", block.Number, rpcResult.Error)
+	}
+
+	if tracer == TracerTraceBlock {
+		return decodeParityTraces(block, rpcResult.Result)
+	}
+	return decodeCallTraces(block, rpcResult.Result)
+}
+
+// decodeCallTraces reads the call trees of the transactions of block. Nodes that do not report the hash
+// of each transaction answer in the order of the block.
+func decodeCallTraces(block *entities.Block, raw json.RawMessage) (map[string][]entities.InternalTransfer, error) {
+	var results []struct {
+		TxHash string     `json:"txHash"`
+		Result *callFrame `json:"result"`
+		Error  string     `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode traces of block %d: %v", block.Number, err)
+	}
+	if len(results) != len(block.Transactions) {
+		return nil, fmt.Errorf("traced %d transactions of block %d instead of %d", len(results), block.Number, len(block.Transactions))
+	}
+
+	transfers := make(map[string][]entities.InternalTransfer)
+	for i, result := range results {
+		hash := block.Transactions[i].Hash
+		if result.TxHash != "" && !strings.EqualFold(result.TxHash, hash) {
+			return nil, fmt.Errorf("traced transaction %s instead of %s in block %d", result.TxHash, hash, block.Number)
+		}
+		if result.Result == nil {
+			return nil, fmt.Errorf("failed to trace %s: %s", hash, result.Error)
+		}
+
+		var found []entities.InternalTransfer
+		position := 0
+		if err := collectCallFrames(*result.Result, false, &position, &found); err != nil {
+			return nil, fmt.Errorf("trace of %s: %v", hash, err)
+		}
+		if len(found) > 0 {
+			transfers[strings.ToLower(hash)] = found
+		}
+	}
+	return transfers, nil
+}
+
+// collectCallFrames visits frame and the calls it made depth first, collecting the ether they moved.
+// Calls that failed, or were made by a call that failed, were reverted and moved nothing.
+func collectCallFrames(frame callFrame, reverted bool, position *int, transfers *[]entities.InternalTransfer) error {
+	index := *position
+	*position++
+	reverted = reverted || frame.Error != ""
+
+	value, err := decodeBigQuantity("value", frame.Value)
+	if err != nil {
+		return err
+	}
+	if index > 0 && !reverted && value != "" && value != "0" {
+		transfer := entities.InternalTransfer{From: frame.From, To: frame.To, Value: value, Index: index}
+		switch frame.Type {
+		case "CALL":
+			transfer.Type = entities.InternalTransferCall
+		case "CREATE", "CREATE2":
+			transfer.Type = entities.InternalTransferCreate
+		case "SELFDESTRUCT":
+			transfer.Type = entities.InternalTransferSelfDestruct
+		}
+		// DELEGATECALL and CALLCODE run code of another contract but keep the ether where it is
+		if transfer.Type != "" {
+			*transfers = append(*transfers, transfer)
+		}
+	}
+
+	for _, call := range frame.Calls {
+		if err := collectCallFrames(call, reverted, position, transfers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeParityTraces reads the flat traces of block, which list the calls of each transaction depth
+// first as the callTracer visits them.
+func decodeParityTraces(block *entities.Block, raw json.RawMessage) (map[string][]entities.InternalTransfer, error) {
+	var traces []parityTrace
+	if err := json.Unmarshal(raw, &traces); err != nil {
+		return nil, fmt.Errorf("failed to decode traces of block %d: %v", block.Number, err)
+	}
+
+	transfers := make(map[string][]entities.InternalTransfer)
+	positions := make(map[string]int)
+	failed := make(map[string][][]int)
+	for _, trace := range traces {
+		if trace.TransactionHash == nil {
+			// Block and uncle rewards are not part of any transaction
+			continue
+		}
+		if trace.BlockHash != "" && block.Hash != "" && !strings.EqualFold(trace.BlockHash, block.Hash) {
+			return nil, fmt.Errorf("trace of block %d belongs to block %s instead of %s", block.Number, trace.BlockHash, block.Hash)
+		}
+
+		hash := strings.ToLower(*trace.TransactionHash)
+		index := positions[hash]
+		positions[hash]++
+		if trace.Error != "" {
+			failed[hash] = append(failed[hash], trace.TraceAddress)
+		}
+		if index == 0 || isWithinAny(trace.TraceAddress, failed[hash]) {
+			continue
+		}
+
+		transfer := entities.InternalTransfer{Index: index}
+		var value string
+		switch {
+		case trace.Type == "call" && trace.Action.CallType == "call":
+			transfer.Type = entities.InternalTransferCall
+			transfer.From, transfer.To, value = trace.Action.From, trace.Action.To, trace.Action.Value
+		case trace.Type == "create" && trace.Result != nil:
+			transfer.Type = entities.InternalTransferCreate
+			transfer.From, transfer.To, value = trace.Action.From, trace.Result.Address, trace.Action.Value
+		case trace.Type == "suicide":
+			transfer.Type = entities.InternalTransferSelfDestruct
+			transfer.From, transfer.To, value = trace.Action.Address, trace.Action.RefundAddress, trace.Action.Balance
+		default:
+			continue
+		}
+
+		var err error
+		if transfer.Value, err = decodeBigQuantity("value", value); err != nil {
+			return nil, fmt.Errorf("trace of %s: %v", hash, err)
+		}
+		if transfer.Value != "" && transfer.Value != "0" {
+			transfers[hash] = append(transfers[hash], transfer)
+		}
+	}
+	return transfers, nil
+}
+
+// isWithinAny reports whether the call at traceAddress is one of prefixes or was made under one of them.
+func isWithinAny(traceAddress []int, prefixes [][]int) bool {
+	for _, prefix := range prefixes {
+		if len(prefix) > len(traceAddress) {
+			continue
+		}
+		within := true
+		for i := range prefix {
+			if prefix[i] != traceAddress[i] {
+				within = false
+				break
+			}
+		}
+		if within {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchInternalTransfers traces each of blocks, grouping the internal transfers by block number.
+func (rpc *EthereumRPC) fetchInternalTransfers(blocks []*entities.Block, priority entities.Priority) (map[int64]map[string][]entities.InternalTransfer, error) {
+	internal := make(map[int64]map[string][]entities.InternalTransfer)
+	for _, block := range blocks {
+		transfers, err := rpc.Methods.GetInternalTransfers(block, priority)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", block.Number, err)
+		}
+		internal[block.Number] = transfers
+	}
+	return internal, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const router = "0x3333333333333333333333333333333333333333"
+
+var tracedBlock = &entities.Block{Number: 101, Hash: "a101", Transactions: []entities.Transaction{{Hash: "h1", From: sender, To: router}}}
+
+// The same call tree as seen by both tracers: an unwrap paying the wallet, a reverted call that would
+// have paid it too, a delegate call and a contract creation.
+const (
+	callTracerResult = `[{"txHash":"h1","result":{"type":"CALL","from":"` + sender + `","to":"` + router + `","value":"0x0","calls":[
+		{"type":"CALL","from":"` + router + `","to":"0xweth","value":"0x0"},
+		{"type":"CALL","from":"` + router + `","to":"` + wallet + `","value":"0xde0b6b3a7640000"},
+		{"type":"CALL","from":"` + router + `","to":"0xother","value":"0x5","error":"execution reverted","calls":[
+			{"type":"CALL","from":"0xother","to":"` + wallet + `","value":"0x7"}
+		]},
+		{"type":"DELEGATECALL","from":"` + router + `","to":"0xlib","value":"0x9"},
+		{"type":"CREATE","from":"` + router + `","to":"0xnew","value":"0x2"}
+	]}}]`
+	traceBlockResult = `[
+		{"type":"call","action":{"callType":"call","from":"` + sender + `","to":"` + router + `","value":"0x0"},"traceAddress":[],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"call","action":{"callType":"call","from":"` + router + `","to":"0xweth","value":"0x0"},"traceAddress":[0],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"call","action":{"callType":"call","from":"` + router + `","to":"` + wallet + `","value":"0xde0b6b3a7640000"},"traceAddress":[1],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"call","action":{"callType":"call","from":"` + router + `","to":"0xother","value":"0x5"},"error":"Reverted","traceAddress":[2],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"call","action":{"callType":"call","from":"0xother","to":"` + wallet + `","value":"0x7"},"traceAddress":[2,0],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"call","action":{"callType":"delegatecall","from":"` + router + `","to":"0xlib","value":"0x9"},"traceAddress":[3],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"create","action":{"from":"` + router + `","value":"0x2"},"result":{"address":"0xnew"},"traceAddress":[4],"blockHash":"a101","transactionHash":"h1"},
+		{"type":"reward","action":{"author":"0xminer","value":"0x1bc16d674ec80000"},"traceAddress":[],"blockHash":"a101","transactionHash":null}
+	]`
+)
+
+var expectedInternalTransfers = map[string][]entities.InternalTransfer{
+	"h1": {
+		{Type: entities.InternalTransferCall, From: router, To: wallet, Value: "1000000000000000000", Index: 2},
+		{Type: entities.InternalTransferCreate, From: router, To: "0xnew", Value: "2", Index: 6},
+	},
+}
+
+func TestDecodeTracesOfBothTracers(t *testing.T) {
+	transfers, err := decodeCallTraces(tracedBlock, []byte(callTracerResult))
+	require.NoError(t, err)
+	assert.Equal(t, expectedInternalTransfers, transfers)
+
+	transfers, err = decodeParityTraces(tracedBlock, []byte(traceBlockResult))
+	require.NoError(t, err)
+	assert.Equal(t, expectedInternalTransfers, transfers, "both tracers should number the calls the same way")
+
+	_, err = decodeParityTraces(&entities.Block{Number: 101, Hash: "b101"}, []byte(traceBlockResult))
+	assert.Error(t, err, "traces of another block at the same height are rejected")
+}
+
+func TestGetInternalTransfersUsesTracingProviders(t *testing.T) {
+	var plainRequests int32
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&plainRequests, 1)
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)
+	}))
+	defer plain.Close()
+	var tracedMethod string
+	tracing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		tracedMethod = string(body)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":%s}`, traceBlockResult)
+	}))
+	defer tracing.Close()
+
+	pool := NewProviderPool([]string{plain.URL, tracing.URL}, &http.Client{})
+	service := EthereumRPC{Providers: pool}
+
+	transfers, err := service.GetInternalTransfers(tracedBlock, entities.PriorityTip)
+	assert.NoError(t, err)
+	assert.Nil(t, transfers, "nothing is traced without a tracing provider")
+
+	pool.SetTracer(tracing.URL, TracerTraceBlock)
+	transfers, err = service.GetInternalTransfers(tracedBlock, entities.PriorityTip)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedInternalTransfers, transfers)
+	assert.True(t, strings.Contains(tracedMethod, `"trace_block"`))
+	assert.Zero(t, atomic.LoadInt32(&plainRequests), "providers without a tracer are never asked for traces")
+}
+
+func TestMatchInternalTransfers(t *testing.T) {
+	index := newAddressIndex(map[string]int64{wallet: 100})
+
+	matches := index.match(*tracedBlock, nil, expectedInternalTransfers)
+	require.Len(t, matches[wallet], 1)
+	assert.Equal(t, entities.TransactionKindInternal, matches[wallet][0].Kind)
+	assert.Equal(t, "h1", matches[wallet][0].Hash)
+	assert.Equal(t, &expectedInternalTransfers["h1"][0], matches[wallet][0].Internal)
+}
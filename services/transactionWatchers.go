@@ -0,0 +1,156 @@
+package services
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// transactionWatch records which of its addresses were signalled, behind a single coalesced signal.
+type transactionWatch struct {
+	rpc    *EthereumRPC
+	signal chan struct{}
+
+	mu        sync.Mutex
+	addresses map[string]bool
+	ready     map[string]bool
+}
+
+// Ensures that transactionWatch implements TransactionWatch
+var _ interfaces.TransactionWatch = (*transactionWatch)(nil)
+
+// WatchTransactions returns a channel signalled when transactions of address may be ready to read: when
+// some are stored, and after every processed block while some are stored, since it may settle those
+// waiting for confirmations.
+// Signals are coalesced, so readers fetch everything after their cursor each time. The returned function
+// stops the signals and must be called once the channel is no longer read.
+func (rpc *EthereumRPC) WatchTransactions(address string) (<-chan struct{}, func()) {
+	watch := rpc.newWatch()
+	watch.follow(address)
+	return watch.signal, watch.Stop
+}
+
+// WatchAddresses returns a watch following any number of addresses with the signals of WatchTransactions.
+func (rpc *EthereumRPC) WatchAddresses() interfaces.TransactionWatch {
+	return rpc.newWatch()
+}
+
+func (rpc *EthereumRPC) newWatch() *transactionWatch {
+	return &transactionWatch{
+		rpc:       rpc,
+		signal:    make(chan struct{}, 1),
+		addresses: make(map[string]bool),
+		ready:     make(map[string]bool),
+	}
+}
+
+func (w *transactionWatch) Add(address string) {
+	w.follow(address)
+	w.notify(address)
+}
+
+// follow registers the watch for the signals of address.
+func (w *transactionWatch) follow(address string) {
+	w.mu.Lock()
+	w.addresses[address] = true
+	w.mu.Unlock()
+
+	w.rpc.watchersMu.Lock()
+	defer w.rpc.watchersMu.Unlock()
+	if w.rpc.watchers == nil {
+		w.rpc.watchers = make(map[string]map[*transactionWatch]bool)
+	}
+	if w.rpc.watchers[address] == nil {
+		w.rpc.watchers[address] = make(map[*transactionWatch]bool)
+	}
+	w.rpc.watchers[address][w] = true
+}
+
+func (w *transactionWatch) Remove(address string) {
+	w.mu.Lock()
+	delete(w.addresses, address)
+	delete(w.ready, address)
+	w.mu.Unlock()
+
+	w.rpc.watchersMu.Lock()
+	defer w.rpc.watchersMu.Unlock()
+	w.rpc.unwatch(address, w)
+}
+
+func (w *transactionWatch) Signal() <-chan struct{} {
+	return w.signal
+}
+
+func (w *transactionWatch) Ready() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	addresses := make([]string, 0, len(w.ready))
+	for address := range w.ready {
+		addresses = append(addresses, address)
+	}
+	w.ready = make(map[string]bool)
+	sort.Strings(addresses)
+	return addresses
+}
+
+func (w *transactionWatch) Stop() {
+	w.mu.Lock()
+	addresses := w.addresses
+	w.addresses = make(map[string]bool)
+	w.ready = make(map[string]bool)
+	w.mu.Unlock()
+
+	w.rpc.watchersMu.Lock()
+	defer w.rpc.watchersMu.Unlock()
+	for address := range addresses {
+		w.rpc.unwatch(address, w)
+	}
+}
+
+// notify marks address ready, without waiting for a slow reader.
+func (w *transactionWatch) notify(address string) {
+	w.mu.Lock()
+	if !w.addresses[address] {
+		w.mu.Unlock()
+		return
+	}
+	w.ready[address] = true
+	w.mu.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// unwatch must be called with watchersMu held.
+func (rpc *EthereumRPC) unwatch(address string, watch *transactionWatch) {
+	delete(rpc.watchers[address], watch)
+	if len(rpc.watchers[address]) == 0 {
+		delete(rpc.watchers, address)
+	}
+}
+
+// notifyWatchers signals the watchers of address, or of every address with stored transactions when it
+// is empty, without waiting for slow ones.
+func (rpc *EthereumRPC) notifyWatchers(address string) {
+	rpc.watchersMu.Lock()
+	defer rpc.watchersMu.Unlock()
+	if address != "" {
+		for watch := range rpc.watchers[address] {
+			watch.notify(address)
+		}
+		return
+	}
+	for watched, watches := range rpc.watchers {
+		// Readers of addresses without transactions have nothing waiting for confirmations
+		stored, _, err := rpc.Storage.Transactions.Find(watched)
+		if err == nil && len(stored) == 0 {
+			continue
+		}
+		for watch := range watches {
+			watch.notify(watched)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signalled(signal <-chan struct{}) bool {
+	select {
+	case <-signal:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWatchTransactionsSignalsStoredTransactions(t *testing.T) {
+	subscriptions := storages.NewSubscriptionStorage()
+	subscriptions.Save(wallet, int64(100))
+	subscriptions.Save(sender, int64(100))
+	service := EthereumRPC{
+		Storage: newTestStorage(subscriptions, nil),
+	}
+
+	first, stopFirst := service.WatchTransactions(wallet)
+	second, stopSecond := service.WatchTransactions(wallet)
+	other, stopOther := service.WatchTransactions(sender)
+	defer stopOther()
+
+	require.NoError(t, service.Events().Publish(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{{Hash: "0x1"}}}))
+	require.NoError(t, service.Events().Publish(entities.TransactionMatched{Address: wallet, Transactions: []entities.Transaction{{Hash: "0x2"}}}))
+	assert.Eventually(t, func() bool {
+		return subscriberStats(service.Events(), "streams").Delivered == 2
+	}, time.Second, time.Millisecond)
+	assert.True(t, signalled(first))
+	assert.False(t, signalled(first), "signals are coalesced")
+	assert.True(t, signalled(second))
+	assert.False(t, signalled(other), "only watchers of the address are signalled")
+
+	stopFirst()
+	service.notifyWatchers("")
+	assert.False(t, signalled(first), "stopped watchers are no longer signalled")
+	assert.True(t, signalled(second))
+	assert.False(t, signalled(other), "processed blocks only signal addresses with stored transactions")
+
+	stopSecond()
+	assert.NotContains(t, service.watchers, wallet)
+}
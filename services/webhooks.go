@@ -0,0 +1,445 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+)
+
+const (
+	webhookInterval    = 5 * time.Second  // Time between delivery rounds when no transaction is stored
+	webhookBatchSize   = 100              // Transactions sent per payload
+	webhookMaxAttempts = 8                // Attempts of a payload before it is parked in the dead letters
+	webhookHistorySize = 20               // Delivery attempts kept per webhook
+	webhookTimeout     = 10 * time.Second // Time a delivery, or the lookup of a webhook host, may take
+
+	// Headers of the webhook requests. The signature is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+	// by the secret of the webhook, receivers reject old timestamps to prevent replays.
+	webhookIDHeader        = "X-Notifier-Delivery"
+	webhookTimestampHeader = "X-Notifier-Timestamp"
+	webhookSignatureHeader = "X-Notifier-Signature"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, internal like the private ranges.
+var _, sharedAddressSpace, _ = net.ParseCIDR("100.64.0.0/10")
+
+var webhookRetryPolicy = RetryPolicy{
+	MaxAttempts: webhookMaxAttempts,
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    10 * time.Minute,
+}
+
+func webhookKey(address string, consumer string) string {
+	return address + "/" + consumer
+}
+
+// SetWebhook pushes the transactions of consumer on address to url, replacing its previous webhook.
+// Transactions are acknowledged for consumer as they are delivered.
+func (rpc *EthereumRPC) SetWebhook(address string, consumer string, webhookURL string, secret string) error {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || secret == "" {
+		return entities.ErrInvalidWebhook
+	}
+	if err := rpc.checkWebhookHost(parsed.Hostname()); err != nil {
+		return err
+	}
+
+	rpc.mu.Lock()
+	defer rpc.mu.Unlock()
+	if _, err := rpc.consumerCursor(address, consumer); err != nil {
+		return err
+	}
+	if _, subscribed, err := rpc.Storage.Subscriptions.Find(address); err != nil || !subscribed {
+		return fmt.Errorf("%w: %q on %s", entities.ErrConsumerNotFound, consumer, address)
+	}
+
+	key := webhookKey(address, consumer)
+	webhook, _, err := rpc.Storage.Webhooks.Find(key)
+	if err != nil {
+		return err
+	}
+	webhook.Address, webhook.Consumer, webhook.URL, webhook.Secret = address, consumer, webhookURL, secret
+	if err := rpc.Storage.Webhooks.Save(key, webhook); err != nil {
+		return err
+	}
+	rpc.wakeWebhooks()
+	return nil
+}
+
+// checkWebhookHost rejects hosts resolving to loopback, private, link-local or otherwise internal
+// addresses, so that subscribers cannot make the server POST to internal services. The webhook client
+// checks the address again when dialing, in case the host resolves differently by then.
+func (rpc *EthereumRPC) checkWebhookHost(host string) error {
+	if rpc.privateWebhooks {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", entities.ErrInvalidWebhook, err)
+	}
+	for _, address := range addresses {
+		if !publicIP(address.IP) {
+			return fmt.Errorf("%w: %s resolves to the internal address %s", entities.ErrInvalidWebhook, host, address.IP)
+		}
+	}
+	return nil
+}
+
+// publicIP reports whether ip is routable on the internet.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !sharedAddressSpace.Contains(ip)
+}
+
+// newWebhookClient returns the client delivering webhooks, which refuses to connect to internal addresses
+// whatever the host resolves to at that time, redirects included. It bypasses the proxies of the
+// environment so that the address checked is the one of the receiver.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("webhook to internal address %s refused", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// RemoveWebhook stops pushing the transactions of consumer on address, which are read through the API again.
+func (rpc *EthereumRPC) RemoveWebhook(address string, consumer string) (bool, error) {
+	key := webhookKey(address, consumer)
+	_, exists, err := rpc.Storage.Webhooks.Find(key)
+	if err != nil || !exists {
+		return false, err
+	}
+	return true, rpc.Storage.Webhooks.Delete(key)
+}
+
+// removeWebhooks removes the webhooks of every consumer of address.
+func (rpc *EthereumRPC) removeWebhooks(address string) error {
+	var keys []string
+	err := rpc.Storage.Webhooks.Range(func(key string, webhook entities.Webhook) bool {
+		if webhook.Address == address {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := rpc.Storage.Webhooks.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetWebhooks lists the webhooks of address, or all of them when address is empty, without their secrets.
+func (rpc *EthereumRPC) GetWebhooks(address string) ([]entities.Webhook, error) {
+	webhooks := []entities.Webhook{}
+	err := rpc.Storage.Webhooks.Range(func(_ string, webhook entities.Webhook) bool {
+		if address == "" || webhook.Address == address {
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhookKey(webhooks[i].Address, webhooks[i].Consumer) < webhookKey(webhooks[j].Address, webhooks[j].Consumer)
+	})
+	return webhooks, nil
+}
+
+// GetDeadLetters lists the payloads that could not be delivered, oldest first, without their secrets.
+func (rpc *EthereumRPC) GetDeadLetters() ([]entities.DeadLetter, error) {
+	deadLetters := []entities.DeadLetter{}
+	err := rpc.Storage.DeadLetters.Range(func(_ string, deadLetter entities.DeadLetter) bool {
+		deadLetter.Secret = ""
+		deadLetters = append(deadLetters, deadLetter)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deadLetters, func(i, j int) bool {
+		if deadLetters[i].FailedAt != deadLetters[j].FailedAt {
+			return deadLetters[i].FailedAt < deadLetters[j].FailedAt
+		}
+		return deadLetters[i].ID < deadLetters[j].ID
+	})
+	return deadLetters, nil
+}
+
+// ReplayDeadLetter sends a parked payload once more to the URL it failed on, and forgets it once accepted.
+// A failed replay is recorded in the attempts of the dead letter.
+func (rpc *EthereumRPC) ReplayDeadLetter(id string) error {
+	deadLetter, exists, err := rpc.Storage.DeadLetters.Find(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", entities.ErrDeadLetterNotFound, id)
+	}
+
+	attempt := rpc.postWebhook(deadLetter.URL, deadLetter.Secret, deadLetter.Payload, time.Now())
+	if attempt.Error == "" {
+		return rpc.Storage.DeadLetters.Delete(id)
+	}
+	replayed := deadLetter
+	replayed.Attempts = append(append([]entities.DeliveryAttempt(nil), deadLetter.Attempts...), attempt)
+	if _, err := rpc.Storage.DeadLetters.CompareAndSwap(id, deadLetter, replayed); err != nil {
+		return err
+	}
+	return fmt.Errorf("replay of %s failed: %s", id, attempt.Error)
+}
+
+// StartWebhookDispatcher delivers the transactions of the consumers with a webhook as they are stored,
+// retrying failed deliveries with exponential backoff.
+func (rpc *EthereumRPC) StartWebhookDispatcher() {
+	for {
+		rpc.dispatchWebhooks(time.Now())
+		select {
+		case <-rpc.webhookWake:
+		case <-time.After(webhookInterval):
+		}
+	}
+}
+
+// wakeWebhooks makes the dispatcher look for new transactions without waiting for its next round.
+func (rpc *EthereumRPC) wakeWebhooks() {
+	select {
+	case rpc.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatchWebhooks starts a delivery for every webhook due at now, unless its previous one is still running,
+// so a slow endpoint never holds back the others.
+func (rpc *EthereumRPC) dispatchWebhooks(now time.Time) {
+	webhooks, err := rpc.Storage.Webhooks.GetAll()
+	if err != nil {
+		fmt.Println("Error loading webhooks:", err)
+		return
+	}
+
+	rpc.webhookMu.Lock()
+	defer rpc.webhookMu.Unlock()
+	if rpc.delivering == nil {
+		rpc.delivering = make(map[string]bool)
+	}
+	for key, webhook := range webhooks {
+		if rpc.delivering[key] || webhook.NextAttempt > now.Unix() {
+			continue
+		}
+		rpc.delivering[key] = true
+		go func(key string) {
+			if _, err := rpc.deliverWebhook(key, now); err != nil {
+				fmt.Printf("Error delivering webhook %s: %v\n", key, err)
+			}
+			rpc.webhookMu.Lock()
+			delete(rpc.delivering, key)
+			rpc.webhookMu.Unlock()
+		}(key)
+	}
+}
+
+// deliverWebhook POSTs the next transactions of the webhook stored under key and acknowledges them once
+// accepted. A payload that failed is kept and retried as is, so its ID and transactions never change, and
+// one failing webhookMaxAttempts times is parked in the dead letters and acknowledged, so it stops
+// blocking the transactions after it. It reports whether a payload was accepted.
+func (rpc *EthereumRPC) deliverWebhook(key string, now time.Time) (bool, error) {
+	webhook, exists, err := rpc.Storage.Webhooks.Find(key)
+	if err != nil || !exists {
+		return false, err
+	}
+	payload, err := rpc.nextWebhookPayload(key, webhook)
+	if err != nil || payload == nil {
+		return false, err
+	}
+	last := payload.Transactions[len(payload.Transactions)-1].Sequence
+
+	attempt := rpc.postWebhook(webhook.URL, webhook.Secret, *payload, now)
+	accepted := attempt.Error == ""
+	parked := false
+	err = rpc.updateWebhook(key, func(webhook *entities.Webhook) {
+		webhook.Attempts = append(webhook.Attempts, attempt)
+		if len(webhook.Attempts) > webhookHistorySize {
+			webhook.Attempts = webhook.Attempts[len(webhook.Attempts)-webhookHistorySize:]
+		}
+		if accepted {
+			webhook.Failures, webhook.NextAttempt, webhook.Retrying = 0, 0, nil
+			return
+		}
+		webhook.Failures++
+		if webhook.Failures >= webhookMaxAttempts {
+			parked = true
+			webhook.Failures, webhook.NextAttempt, webhook.Retrying = 0, 0, nil
+			return
+		}
+		webhook.NextAttempt = now.Add(webhookRetryPolicy.backoff(webhook.Failures - 1)).Unix()
+		webhook.Retrying = payload
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if parked {
+		deadLetter := entities.DeadLetter{
+			ID:       fmt.Sprintf("%s@%d", payload.ID, now.Unix()),
+			URL:      webhook.URL,
+			Secret:   webhook.Secret,
+			Payload:  *payload,
+			FailedAt: now.Unix(),
+		}
+		for _, previous := range append(webhook.Attempts, attempt) {
+			if previous.PayloadID == payload.ID {
+				deadLetter.Attempts = append(deadLetter.Attempts, previous)
+			}
+		}
+		if err := rpc.Storage.DeadLetters.Save(deadLetter.ID, deadLetter); err != nil {
+			return false, err
+		}
+		fmt.Printf("Webhook %s failed %d times, parked payload %s\n", key, webhookMaxAttempts, deadLetter.ID)
+	}
+	if !accepted && !parked {
+		return false, nil
+	}
+	err = rpc.AcknowledgeTransactions(webhook.Address, webhook.Consumer, last)
+	if errors.Is(err, entities.ErrStreamNotFound) || errors.Is(err, entities.ErrConsumerNotFound) {
+		// Unsubscribed during the delivery
+		err = nil
+	}
+	return accepted, err
+}
+
+// nextWebhookPayload returns the payload being retried by webhook, or the next transactions of its
+// consumer, or nil when there are none.
+func (rpc *EthereumRPC) nextWebhookPayload(key string, webhook entities.Webhook) (*entities.WebhookPayload, error) {
+	if webhook.Retrying != nil {
+		return webhook.Retrying, nil
+	}
+	stream, _, err := rpc.Storage.Streams.Find(webhook.Address)
+	if err != nil {
+		return nil, err
+	}
+	// Skip the current block lookup of GetTransactionsAfter when nothing new was stored
+	if acknowledged, ok := consumerCursors(stream)[webhook.Consumer]; !ok || acknowledged >= stream.LastSequence {
+		return nil, nil
+	}
+
+	transactions, err := rpc.GetTransactionsAfter(webhook.Address, webhook.Consumer, 0, entities.Finality{})
+	if err != nil || len(transactions) == 0 {
+		return nil, err
+	}
+	if len(transactions) > webhookBatchSize {
+		transactions = transactions[:webhookBatchSize]
+	}
+	first, last := transactions[0].Sequence, transactions[len(transactions)-1].Sequence
+	return &entities.WebhookPayload{
+		ID:           fmt.Sprintf("%s/%d-%d", key, first, last),
+		Address:      webhook.Address,
+		Consumer:     webhook.Consumer,
+		Transactions: transactions,
+	}, nil
+}
+
+// updateWebhook applies fn to a copy of the webhook stored under key, retrying when it changed
+// concurrently. Webhooks removed in the meantime are left alone.
+func (rpc *EthereumRPC) updateWebhook(key string, fn func(webhook *entities.Webhook)) error {
+	for {
+		webhook, exists, err := rpc.Storage.Webhooks.Find(key)
+		if err != nil || !exists {
+			return err
+		}
+		next := webhook
+		next.Attempts = append([]entities.DeliveryAttempt(nil), webhook.Attempts...)
+		fn(&next)
+
+		swapped, err := rpc.Storage.Webhooks.CompareAndSwap(key, webhook, next)
+		if errors.Is(err, storages.ErrNotFound) {
+			return nil
+		}
+		if err != nil || swapped {
+			return err
+		}
+	}
+}
+
+// postWebhook sends payload to webhookURL signed with secret, and describes the outcome.
+func (rpc *EthereumRPC) postWebhook(webhookURL string, secret string, payload entities.WebhookPayload, now time.Time) entities.DeliveryAttempt {
+	attempt := entities.DeliveryAttempt{PayloadID: payload.ID, At: now.Unix()}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookIDHeader, payload.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(secret, timestamp, body))
+
+	resp, err := rpc.WebhookClient.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			fmt.Println("Error body read closer:", err)
+		}
+	}(resp.Body)
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = "unexpected status " + resp.Status
+	}
+	return attempt
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by secret.
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/storages"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDeliveryRetriesAndDeadLetters(t *testing.T) {
+	var status int32 = http.StatusInternalServerError
+	var payloads []entities.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature := "sha256=" + signWebhook("s3cret", r.Header.Get(webhookTimestampHeader), body)
+		if assert.Equal(t, signature, r.Header.Get(webhookSignatureHeader)) {
+			var payload entities.WebhookPayload
+			assert.NoError(t, json.Unmarshal(body, &payload))
+			assert.Equal(t, payload.ID, r.Header.Get(webhookIDHeader))
+			payloads = append(payloads, payload)
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(110)
+	service := EthereumRPC{
+		Storage:         storages.NewMemoryStorage(),
+		Methods:         mockClient,
+		Finality:        entities.Finality{Tag: entities.FinalityLatest},
+		WebhookClient:   server.Client(),
+		privateWebhooks: true,
+	}
+	_, err := service.subscribe(wallet, "app", 100)
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.SetWebhook(wallet, "app", "ftp://example.com", "s3cret"), entities.ErrInvalidWebhook)
+	assert.ErrorIs(t, service.SetWebhook(wallet, "other", server.URL, "s3cret"), entities.ErrConsumerNotFound)
+	require.NoError(t, service.SetWebhook(wallet, "app", server.URL, "s3cret"))
+	key := webhookKey(wallet, "app")
+
+	now := time.Unix(1700000000, 0)
+	delivered, err := service.deliverWebhook(key, now)
+	require.NoError(t, err)
+	assert.False(t, delivered, "nothing to deliver yet")
+	assert.Empty(t, payloads)
+
+	require.NoError(t, service.storeTransactions(wallet, []entities.Transaction{
+		{Hash: "0x1", From: sender, To: wallet, BlockNumber: 101},
+		{Hash: "0x2", From: wallet, To: sender, BlockNumber: 102},
+	}))
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		delivered, err := service.deliverWebhook(key, now)
+		require.NoError(t, err)
+		assert.False(t, delivered)
+		webhooks, err := service.GetWebhooks(wallet)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		assert.Empty(t, webhooks[0].Secret, "secrets are never listed")
+		if attempt < webhookMaxAttempts {
+			assert.Equal(t, attempt, webhooks[0].Failures)
+			assert.GreaterOrEqual(t, webhooks[0].NextAttempt, now.Unix())
+		}
+		now = now.Add(webhookRetryPolicy.MaxDelay)
+	}
+	require.Len(t, payloads, webhookMaxAttempts)
+	assert.Equal(t, wallet+"/app/1-2", payloads[0].ID)
+	assert.Equal(t, payloads[0], payloads[webhookMaxAttempts-1], "retries send the same payload")
+
+	// The parked payload no longer blocks the consumer
+	cursor, err := service.consumerCursor(wallet, "app")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), cursor)
+	deadLetters, err := service.GetDeadLetters()
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, payloads[0], deadLetters[0].Payload)
+	assert.Len(t, deadLetters[0].Attempts, webhookMaxAttempts)
+	assert.Equal(t, http.StatusInternalServerError, deadLetters[0].Attempts[0].StatusCode)
+	assert.Empty(t, deadLetters[0].Secret)
+
+	require.Error(t, service.ReplayDeadLetter(deadLetters[0].ID))
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	require.NoError(t, service.ReplayDeadLetter(deadLetters[0].ID))
+	deadLetters, err = service.GetDeadLetters()
+	require.NoError(t, err)
+	assert.Empty(t, deadLetters)
+	assert.ErrorIs(t, service.ReplayDeadLetter("missing"), entities.ErrDeadLetterNotFound)
+
+	// The next transaction is delivered and acknowledged at once
+	require.NoError(t, service.storeTransactions(wallet, []entities.Transaction{{Hash: "0x3", From: sender, To: wallet, BlockNumber: 103}}))
+	delivered, err = service.deliverWebhook(key, now)
+	require.NoError(t, err)
+	assert.True(t, delivered)
+	assert.Equal(t, wallet+"/app/3-3", payloads[len(payloads)-1].ID)
+	cursor, err = service.consumerCursor(wallet, "app")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), cursor)
+
+	assert.True(t, service.Unsubscribe(wallet))
+	webhooks, err := service.GetWebhooks("")
+	require.NoError(t, err)
+	assert.Empty(t, webhooks, "unsubscribing removes the webhooks of the address")
+}
+
+func TestWebhookRetriesSendTheSameBatch(t *testing.T) {
+	var status int32 = http.StatusServiceUnavailable
+	var payloads []entities.WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload entities.WebhookPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads = append(payloads, payload)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(110)
+	service := EthereumRPC{
+		Storage:         storages.NewMemoryStorage(),
+		Methods:         mockClient,
+		Finality:        entities.Finality{Tag: entities.FinalityLatest},
+		WebhookClient:   server.Client(),
+		privateWebhooks: true,
+	}
+	_, err := service.subscribe(wallet, "app", 100)
+	require.NoError(t, err)
+	require.NoError(t, service.SetWebhook(wallet, "app", server.URL, "s3cret"))
+	key := webhookKey(wallet, "app")
+
+	now := time.Unix(1700000000, 0)
+	require.NoError(t, service.storeTransactions(wallet, []entities.Transaction{{Hash: "0x1", From: sender, To: wallet, BlockNumber: 101}}))
+	delivered, err := service.deliverWebhook(key, now)
+	require.NoError(t, err)
+	assert.False(t, delivered)
+
+	// More transactions confirm before the retry, which still sends the batch that failed
+	require.NoError(t, service.storeTransactions(wallet, []entities.Transaction{{Hash: "0x2", From: wallet, To: sender, BlockNumber: 102}}))
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	delivered, err = service.deliverWebhook(key, now.Add(webhookRetryPolicy.MaxDelay))
+	require.NoError(t, err)
+	assert.True(t, delivered)
+	require.Len(t, payloads, 2)
+	assert.Equal(t, payloads[0], payloads[1])
+	assert.Equal(t, wallet+"/app/1-1", payloads[1].ID)
+
+	webhooks, err := service.GetWebhooks(wallet)
+	require.NoError(t, err)
+	assert.Nil(t, webhooks[0].Retrying, "an accepted batch is not retried")
+	delivered, err = service.deliverWebhook(key, now.Add(webhookRetryPolicy.MaxDelay))
+	require.NoError(t, err)
+	assert.True(t, delivered)
+	assert.Equal(t, wallet+"/app/2-2", payloads[2].ID)
+}
+
+func TestWebhooksRefuseInternalHosts(t *testing.T) {
+	service := EthereumRPC{Storage: storages.NewMemoryStorage()}
+	_, err := service.subscribe(wallet, "app", 100)
+	require.NoError(t, err)
+	for _, target := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"https://10.0.0.7/hooks",
+		"http://[::1]/hooks",
+		"http://100.64.0.1/hooks",
+	} {
+		assert.ErrorIs(t, service.SetWebhook(wallet, "app", target, "s3cret"), entities.ErrInvalidWebhook, target)
+	}
+	assert.NoError(t, service.SetWebhook(wallet, "app", "https://203.0.113.10/hooks", "s3cret"))
+
+	// A host resolving to an internal address after registration is refused when dialing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the webhook reached an internal address")
+	}))
+	defer server.Close()
+	service.WebhookClient = newWebhookClient()
+	attempt := service.postWebhook(server.URL, "s3cret", entities.WebhookPayload{ID: "1"}, time.Now())
+	assert.Contains(t, attempt.Error, "internal address")
+}
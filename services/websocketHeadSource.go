@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/websockets"
+)
+
+const (
+	newHeadsRequestID               = 1
+	pendingTransactionsRequestID    = 2
+	pendingHashesRequestID          = 3
+	defaultWebSocketIdleTimeout     = 60 * time.Second
+	defaultWebSocketDialTimeout     = 10 * time.Second
+	ethSubscriptionNotification     = "eth_subscription"
+	newHeadsSubscription            = "newHeads"
+	pendingTransactionsSubscription = "newPendingTransactions"
+)
+
+// WebSocketHeadSource reports the chain head through an eth_subscribe("newHeads") subscription.
+type WebSocketHeadSource struct {
+	URL         string
+	IdleTimeout time.Duration
+	// PendingTransactions optionally receives the transactions announced by newPendingTransactions. Nodes
+	// that only announce hashes give transactions with nothing but their Hash set.
+	PendingTransactions chan<- entities.Transaction
+}
+
+// Ensures that WebSocketHeadSource implements HeadSource
+var _ interfaces.HeadSource = (*WebSocketHeadSource)(nil)
+
+func NewWebSocketHeadSource(url string) *WebSocketHeadSource {
+	return &WebSocketHeadSource{
+		URL:         url,
+		IdleTimeout: defaultWebSocketIdleTimeout,
+	}
+}
+
+// WatchHeads returns an error as soon as the connection drops, so the watcher can fall back to polling.
+// Heads are handed over by a separate goroutine keeping only the latest one, so a busy watcher never
+// stalls the reads and gets the newest head once it is ready.
+func (s *WebSocketHeadSource) WatchHeads(heads chan<- int64, stop <-chan struct{}) error {
+	conn, err := websockets.Dial(s.URL, defaultWebSocketDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	latest := make(chan int64, 1)
+	forwarded := make(chan struct{})
+	defer func() {
+		close(done)
+		<-forwarded
+	}()
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		conn.Close()
+	}()
+	go forwardHeads(latest, heads, stop, done, forwarded)
+
+	if err := conn.WriteMessage([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_subscribe","params":["%s"]}`, newHeadsRequestID, newHeadsSubscription))); err != nil {
+		return err
+	}
+	if s.PendingTransactions != nil {
+		if err := conn.WriteMessage([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_subscribe","params":["%s", true]}`, pendingTransactionsRequestID, pendingTransactionsSubscription))); err != nil {
+			return err
+		}
+	}
+
+	subscriptions := make(map[string]string)
+	for {
+		if s.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+
+		var message struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+			Params struct {
+				Subscription string          `json:"subscription"`
+				Result       json.RawMessage `json:"result"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		if message.Error != nil && message.ID == pendingTransactionsRequestID {
+			// Older nodes only announce hashes
+			if err := conn.WriteMessage([]byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_subscribe","params":["%s"]}`, pendingHashesRequestID, pendingTransactionsSubscription))); err != nil {
+				return err
+			}
+			continue
+		}
+		if message.Error != nil && message.ID == pendingHashesRequestID {
+			fmt.Printf("Pending transactions are not available: %s (Code: %d)\n", message.Error.Message, message.Error.Code)
+			continue
+		}
+		if message.Error != nil {
+			return fmt.Errorf("eth_subscribe failed: %s (Code: %d)", message.Error.Message, message.Error.Code)
+		}
+
+		if message.Method != ethSubscriptionNotification {
+			// Subscription confirmation, remember which kind the returned id belongs to
+			var subscriptionID string
+			if err := json.Unmarshal(message.Result, &subscriptionID); err != nil {
+				continue
+			}
+			if message.ID == newHeadsRequestID {
+				subscriptions[subscriptionID] = newHeadsSubscription
+			} else if message.ID == pendingTransactionsRequestID || message.ID == pendingHashesRequestID {
+				subscriptions[subscriptionID] = pendingTransactionsSubscription
+			}
+			continue
+		}
+
+		switch subscriptions[message.Params.Subscription] {
+		case newHeadsSubscription:
+			var head struct {
+				Number string `json:"number"`
+			}
+			if err := json.Unmarshal(message.Params.Result, &head); err != nil {
+				continue
+			}
+			number, err := strconv.ParseInt(head.Number, 0, 64)
+			if err != nil {
+				continue
+			}
+			replaceLatest(latest, number)
+		case pendingTransactionsSubscription:
+			var tx entities.Transaction
+			var full rpcTransaction
+			if err := json.Unmarshal(message.Params.Result, &tx.Hash); err != nil {
+				if err := json.Unmarshal(message.Params.Result, &full); err != nil {
+					continue
+				}
+				if tx, err = full.decode(&entities.Block{}); err != nil {
+					continue
+				}
+			}
+			select {
+			case s.PendingTransactions <- tx:
+			default:
+				// Pending announcements are best effort, never stall head tracking for them
+			}
+		}
+	}
+}
+
+// replaceLatest puts number in latest, replacing the head it may still hold. It is the only sender.
+func replaceLatest(latest chan int64, number int64) {
+	select {
+	case <-latest:
+	default:
+	}
+	latest <- number
+}
+
+// forwardHeads sends the heads of latest to the watcher until stop or done. Once done, the newest head
+// still waiting is only handed over if the watcher has room for it.
+func forwardHeads(latest <-chan int64, heads chan<- int64, stop <-chan struct{}, done <-chan struct{}, forwarded chan<- struct{}) {
+	defer close(forwarded)
+	for {
+		var number int64
+		select {
+		case number = <-latest:
+		case <-stop:
+			return
+		case <-done:
+			select {
+			case number = <-latest:
+			default:
+				return
+			}
+			select {
+			case heads <- number:
+			default:
+			}
+			return
+		}
+
+		select {
+		case heads <- number:
+		case <-stop:
+			return
+		case <-done:
+			select {
+			case number = <-latest:
+			default:
+			}
+			select {
+			case heads <- number:
+			default:
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/services/mocks"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/websockets"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newNodeStandIn emulates a node answering eth_subscribe and then pushing the given notifications.
+func newNodeStandIn(t *testing.T, notifications []string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websockets.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var request struct {
+			ID     int      `json:"id"`
+			Method string   `json:"method"`
+			Params []string `json:"params"`
+		}
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		assert.Equal(t, "eth_subscribe", request.Method)
+		assert.Equal(t, []string{"newHeads"}, request.Params)
+
+		conn.WriteMessage([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xsub"}`))
+		for _, notification := range notifications {
+			conn.WriteMessage([]byte(notification))
+		}
+	}))
+}
+
+func headNotification(number string) string {
+	return `{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub","result":{"number":"` + number + `"}}}`
+}
+
+func TestWebSocketHeadSourceWatchHeads(t *testing.T) {
+	server := newNodeStandIn(t, []string{headNotification("0x10"), headNotification("0x11")})
+	defer server.Close()
+
+	source := NewWebSocketHeadSource("ws" + strings.TrimPrefix(server.URL, "http"))
+	heads := make(chan int64, 10)
+
+	err := source.WatchHeads(heads, nil)
+	assert.Error(t, err, "the source should fail once the node closes the connection")
+
+	// A head the watcher did not take yet is replaced by the next one
+	require.NotEmpty(t, heads)
+	var last int64
+	for len(heads) > 0 {
+		head := <-heads
+		assert.Greater(t, head, last)
+		last = head
+	}
+	assert.Equal(t, int64(17), last)
+}
+
+func TestWebSocketHeadSourceKeepsReadingWhileWatcherIsBusy(t *testing.T) {
+	notifications := make([]string, 0, 50)
+	for number := 0x10; number < 0x10+50; number++ {
+		notifications = append(notifications, headNotification(fmt.Sprintf("0x%x", number)))
+	}
+	sent := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websockets.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		conn.WriteMessage([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xsub"}`))
+		for _, notification := range notifications {
+			if err := conn.WriteMessage([]byte(notification)); err != nil {
+				return
+			}
+		}
+		close(sent)
+		<-release
+	}))
+	defer server.Close()
+
+	source := NewWebSocketHeadSource("ws" + strings.TrimPrefix(server.URL, "http"))
+	heads := make(chan int64)
+	stop := make(chan struct{})
+	defer close(stop)
+	go source.WatchHeads(heads, stop)
+
+	// Nobody takes the heads until the node sent them all
+	select {
+	case <-sent:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the source stopped reading while the watcher was busy")
+	}
+	latest := int64(0x10 + 49)
+	assert.Eventually(t, func() bool {
+		select {
+		case head := <-heads:
+			return head == latest
+		default:
+			return false
+		}
+	}, 3*time.Second, 10*time.Millisecond, "the watcher should get the newest head, not the backlog")
+}
+
+func TestWatchHeadsFallsBackToPolling(t *testing.T) {
+	server := newNodeStandIn(t, []string{headNotification("0x10")})
+	defer server.Close()
+
+	mockClient := new(mocks.MockHTTPClient)
+	mockClient.On("GetCurrentBlock").Return(200)
+
+	service := EthereumRPC{
+		Methods:         mockClient,
+		HeadSource:      NewWebSocketHeadSource("ws" + strings.TrimPrefix(server.URL, "http")),
+		headSourceRetry: time.Minute,
+	}
+
+	heads := make(chan int64, 10)
+	stop := make(chan struct{})
+	assert.False(t, service.pollsTxPool(), "the websocket announces the mempool")
+	go service.watchHeads(heads, stop)
+	defer close(stop)
+
+	assert.Equal(t, int64(16), <-heads, "the first head should come from the websocket")
+	select {
+	case head := <-heads:
+		assert.Equal(t, int64(200), head, "the next head should come from HTTP polling")
+		assert.True(t, service.pollsTxPool(), "the mempool is polled while the websocket is down")
+	case <-time.After(3 * time.Second):
+		t.Fatal("watcher did not fall back to polling")
+	}
+}
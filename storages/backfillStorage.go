@@ -0,0 +1,18 @@
+package storages
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// BackfillStorage manages the history scans of the addresses subscribed from a past block.
+type BackfillStorage = MapStorage[string, entities.Backfill]
+
+// Ensures that BackfillStorage implements Storage
+var _ interfaces.Storage[string, entities.Backfill] = (*BackfillStorage)(nil)
+
+func NewBackfillStorage() *BackfillStorage {
+	return NewMapStorage[string, entities.Backfill](func(a, b entities.Backfill) bool {
+		return a == b
+	})
+}
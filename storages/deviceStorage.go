@@ -0,0 +1,16 @@
+package storages
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// DeviceStorage manages the devices notified of the transactions of each address.
+type DeviceStorage = MapStorage[string, []entities.Device]
+
+// Ensures that DeviceStorage implements Storage
+var _ interfaces.Storage[string, []entities.Device] = (*DeviceStorage)(nil)
+
+func NewDeviceStorage() *DeviceStorage {
+	return NewMapStorage[string, []entities.Device](nil)
+}
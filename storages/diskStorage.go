@@ -0,0 +1,457 @@
+package storages
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// defaultCompactEvery is the number of log records after which a snapshot is written.
+const defaultCompactEvery = 1000
+
+const (
+	opSave   = "save"
+	opDelete = "delete"
+	opUpdate = "update"
+	opAppend = "append"
+)
+
+// logRecord is one mutation of the append-only log.
+type logRecord struct {
+	Seq   uint64          `json:"seq"`
+	Op    string          `json:"op"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// snapshot is the full state of a storage up to Seq.
+type snapshot struct {
+	Seq     uint64                     `json:"seq"`
+	Entries map[string]json.RawMessage `json:"entries"`
+}
+
+// DiskStorage persists an in-memory storage in an append-only log. Every mutation is written and
+// synced before it is applied, and a snapshot periodically replaces the log. Records torn by a
+// crash are detected by their checksum and discarded on recovery.
+type DiskStorage[V any] struct {
+	memory       *MapStorage[string, V]
+	merge        func(current V, added V) V
+	logPath      string
+	snapshotPath string
+	CompactEvery int
+
+	mu         sync.Mutex
+	log        logFile
+	seq        uint64
+	logRecords int
+	// broken is set when a failed append could not be cut from the log, later records would follow it.
+	broken error
+}
+
+// logFile is the part of *os.File the log is written through.
+type logFile interface {
+	io.WriteSeeker
+	io.Closer
+	WriteString(s string) (int, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// Ensures that DiskStorage implements Storage
+var _ interfaces.Storage[string, int64] = (*DiskStorage[int64])(nil)
+
+// DiskTransactionStorage is a DiskStorage of transactions that logs appends instead of whole lists.
+type DiskTransactionStorage struct {
+	*DiskStorage[[]entities.Transaction]
+}
+
+// Ensures that DiskTransactionStorage implements TransactionStorage
+var _ interfaces.TransactionStorage = (*DiskTransactionStorage)(nil)
+
+// NewDiskSubscriptionStorage opens, or creates, the subscriptions stored in dir.
+func NewDiskSubscriptionStorage(dir string) (*DiskStorage[int64], error) {
+	return openDiskStorage(dir, "subscriptions", NewSubscriptionStorage(), nil)
+}
+
+// NewDiskStreamStorage opens, or creates, the delivery state stored in dir.
+func NewDiskStreamStorage(dir string) (*DiskStorage[entities.Stream], error) {
+	return openDiskStorage(dir, "streams", NewStreamStorage(), nil)
+}
+
+// NewDiskBackfillStorage opens, or creates, the history scans stored in dir.
+func NewDiskBackfillStorage(dir string) (*DiskStorage[entities.Backfill], error) {
+	return openDiskStorage(dir, "backfills", NewBackfillStorage(), nil)
+}
+
+// NewDiskPendingStorage opens, or creates, the mempool transactions stored in dir.
+func NewDiskPendingStorage(dir string) (*DiskStorage[entities.PendingTransaction], error) {
+	return openDiskStorage(dir, "pending", NewPendingStorage(), nil)
+}
+
+// NewDiskWebhookStorage opens, or creates, the webhooks stored in dir.
+func NewDiskWebhookStorage(dir string) (*DiskStorage[entities.Webhook], error) {
+	return openDiskStorage(dir, "webhooks", NewWebhookStorage(), nil)
+}
+
+// NewDiskDeadLetterStorage opens, or creates, the undelivered webhook payloads stored in dir.
+func NewDiskDeadLetterStorage(dir string) (*DiskStorage[entities.DeadLetter], error) {
+	return openDiskStorage(dir, "deadletters", NewDeadLetterStorage(), nil)
+}
+
+// NewDiskDeviceStorage opens, or creates, the devices registered in dir.
+func NewDiskDeviceStorage(dir string) (*DiskStorage[[]entities.Device], error) {
+	return openDiskStorage(dir, "devices", NewDeviceStorage(), nil)
+}
+
+// NewDiskTransactionStorage opens, or creates, the transactions stored in dir.
+func NewDiskTransactionStorage(dir string) (*DiskTransactionStorage, error) {
+	storage, err := openDiskStorage(dir, "transactions", NewTransactionStorage().MapStorage, appendTransactions)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskTransactionStorage{DiskStorage: storage}, nil
+}
+
+func (d *DiskTransactionStorage) Append(key string, transactions []entities.Transaction) error {
+	return d.write(opAppend, key, transactions)
+}
+
+func openDiskStorage[V any](dir string, name string, memory *MapStorage[string, V], merge func(current V, added V) V) (*DiskStorage[V], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	d := &DiskStorage[V]{
+		memory:       memory,
+		merge:        merge,
+		logPath:      filepath.Join(dir, name+".log"),
+		snapshotPath: filepath.Join(dir, name+".snapshot"),
+		CompactEvery: defaultCompactEvery,
+	}
+
+	if err := d.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := d.replayLog(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DiskStorage[V]) Save(key string, value V) error {
+	return d.write(opSave, key, value)
+}
+
+func (d *DiskStorage[V]) Delete(key string) error {
+	var none V
+	return d.write(opDelete, key, none)
+}
+
+func (d *DiskStorage[V]) Find(key string) (V, bool, error) {
+	return d.memory.Find(key)
+}
+
+func (d *DiskStorage[V]) Update(key string, value V) error {
+	return d.write(opUpdate, key, value)
+}
+
+func (d *DiskStorage[V]) GetAll() (map[string]V, error) {
+	return d.memory.GetAll()
+}
+
+func (d *DiskStorage[V]) Len() int {
+	return d.memory.Len()
+}
+
+func (d *DiskStorage[V]) Range(fn func(key string, value V) bool) error {
+	return d.memory.Range(fn)
+}
+
+func (d *DiskStorage[V]) CompareAndSwap(key string, old V, new V) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current, exists, _ := d.memory.Find(key)
+	if !exists || !d.memory.equal(current, old) {
+		return false, nil
+	}
+	if err := d.logAndApply(opSave, key, new); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Close releases the log file.
+func (d *DiskStorage[V]) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.log.Close()
+}
+
+// Compact writes a snapshot of the current state and starts a new, empty log.
+func (d *DiskStorage[V]) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.compact()
+}
+
+func (d *DiskStorage[V]) write(op string, key string, value V) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if op == opUpdate {
+		if _, exists, _ := d.memory.Find(key); !exists {
+			return ErrNotFound
+		}
+	}
+	return d.logAndApply(op, key, value)
+}
+
+// logAndApply must be called with d.mu held. The mutation is not applied in memory when it could
+// not be made durable.
+func (d *DiskStorage[V]) logAndApply(op string, key string, value V) error {
+	record := logRecord{Seq: d.seq + 1, Op: op, Key: key}
+	if op != opDelete {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		record.Value = raw
+	}
+
+	if err := d.appendRecord(record); err != nil {
+		return err
+	}
+	d.seq = record.Seq
+	d.apply(op, key, value)
+
+	if d.CompactEvery > 0 && d.logRecords >= d.CompactEvery {
+		if err := d.compact(); err != nil {
+			// The record is durable in the log, compaction is retried on the next write
+			fmt.Println("Error compacting storage:", err)
+		}
+	}
+	return nil
+}
+
+// appendRecord writes record at the end of the log. A record that could not be written and synced in
+// full is cut from the log, otherwise replay would stop at it and drop every record written after it.
+func (d *DiskStorage[V]) appendRecord(record logRecord) error {
+	if d.broken != nil {
+		return d.broken
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	offset, err := d.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)
+	_, err = d.log.WriteString(line)
+	if err == nil {
+		err = d.log.Sync()
+	}
+	if err != nil {
+		if truncateErr := d.truncateLog(offset); truncateErr != nil {
+			d.broken = fmt.Errorf("log %s left with a partial record: %v", d.logPath, truncateErr)
+		}
+		return err
+	}
+	d.logRecords++
+	return nil
+}
+
+// truncateLog cuts the log at offset and writes the next records from there.
+func (d *DiskStorage[V]) truncateLog(offset int64) error {
+	if err := d.log.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := d.log.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	return d.log.Sync()
+}
+
+func (d *DiskStorage[V]) apply(op string, key string, value V) {
+	switch op {
+	case opSave:
+		d.memory.Save(key, value)
+	case opDelete:
+		d.memory.Delete(key)
+	case opUpdate:
+		d.memory.Update(key, value)
+	case opAppend:
+		d.memory.modify(key, func(current V, exists bool) V {
+			return d.merge(current, value)
+		})
+	}
+}
+
+func (d *DiskStorage[V]) decode(raw json.RawMessage) (V, error) {
+	var value V
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func (d *DiskStorage[V]) loadSnapshot() error {
+	data, err := os.ReadFile(d.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("corrupted snapshot %s: %v", d.snapshotPath, err)
+	}
+	for key, raw := range s.Entries {
+		value, err := d.decode(raw)
+		if err != nil {
+			return fmt.Errorf("corrupted snapshot entry %s: %v", key, err)
+		}
+		d.memory.Save(key, value)
+	}
+	d.seq = s.Seq
+	return nil
+}
+
+// replayLog applies the records written after the snapshot and cuts the log at the first torn record.
+func (d *DiskStorage[V]) replayLog() error {
+	file, err := os.OpenFile(d.logPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	var validOffset int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// A line without its newline was torn by a crash
+			break
+		}
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		record, ok := parseRecord(line)
+		if !ok {
+			break
+		}
+
+		var value V
+		if record.Op != opDelete {
+			value, err = d.decode(record.Value)
+			if err != nil {
+				break
+			}
+		}
+		if record.Op == opAppend && d.merge == nil {
+			break
+		}
+		validOffset += int64(len(line))
+
+		// Records already covered by the snapshot are left from an interrupted compaction
+		if record.Seq <= d.seq {
+			continue
+		}
+
+		d.apply(record.Op, record.Key, value)
+		d.seq = record.Seq
+		d.logRecords++
+	}
+
+	if err := file.Truncate(validOffset); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Seek(validOffset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	d.log = file
+	return nil
+}
+
+func parseRecord(line string) (logRecord, bool) {
+	var record logRecord
+	checksum, data, found := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	if !found || fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(data))) != checksum {
+		return record, false
+	}
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return record, false
+	}
+	return record, true
+}
+
+// compact must be called with d.mu held. The snapshot is renamed into place before the log is
+// truncated, so a crash in between only leaves records that replay skips by sequence.
+func (d *DiskStorage[V]) compact() error {
+	entries := make(map[string]json.RawMessage)
+	items, _ := d.memory.GetAll()
+	all, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(all, &entries); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot{Seq: d.seq, Entries: entries})
+	if err != nil {
+		return err
+	}
+
+	tmpPath := d.snapshotPath + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, d.snapshotPath); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(d.snapshotPath))
+
+	if err := d.truncateLog(0); err != nil {
+		return err
+	}
+	d.logRecords = 0
+	d.broken = nil
+	return nil
+}
+
+// syncDir makes a rename durable, it is best effort since not every platform supports it.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
@@ -0,0 +1,222 @@
+package storages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskStoragePersistsAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	subscriptions, err := NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	subscriptions.Save("0x123", int64(100))
+	subscriptions.Save("0x456", int64(200))
+	subscriptions.Update("0x123", int64(150))
+	subscriptions.Delete("0x456")
+	require.NoError(t, subscriptions.Close())
+
+	transactions, err := NewDiskTransactionStorage(dir)
+	require.NoError(t, err)
+	transactions.Append("0x123", []entities.Transaction{{Hash: "h1", BlockNumber: 101}})
+	transactions.Append("0x123", []entities.Transaction{{Hash: "h2", BlockNumber: 102}})
+	require.NoError(t, transactions.Close())
+
+	subscriptions, err = NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	defer subscriptions.Close()
+	all, err := subscriptions.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"0x123": 150}, all)
+
+	transactions, err = NewDiskTransactionStorage(dir)
+	require.NoError(t, err)
+	defer transactions.Close()
+	stored, exists, err := transactions.Find("0x123")
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, []entities.Transaction{{Hash: "h1", BlockNumber: 101}, {Hash: "h2", BlockNumber: 102}}, stored)
+}
+
+func TestDiskStorageCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	transactions, err := NewDiskTransactionStorage(dir)
+	require.NoError(t, err)
+	transactions.CompactEvery = 3
+	for i := 0; i < 7; i++ {
+		transactions.Append("0x123", []entities.Transaction{{Hash: strconv.Itoa(i)}})
+	}
+	require.NoError(t, transactions.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "transactions.snapshot"))
+	require.NoError(t, err, "a snapshot should have been written")
+	assert.Equal(t, 1, countLines(t, filepath.Join(dir, "transactions.log")), "the log should only hold records after the snapshot")
+
+	transactions, err = NewDiskTransactionStorage(dir)
+	require.NoError(t, err)
+	defer transactions.Close()
+	stored, _, _ := transactions.Find("0x123")
+	assert.Len(t, stored, 7)
+}
+
+func TestDiskStorageDiscardsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	subscriptions, err := NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	subscriptions.Save("0x123", int64(100))
+	require.NoError(t, subscriptions.Close())
+
+	// Simulate a crash in the middle of writing the next record
+	logFile, err := os.OpenFile(filepath.Join(dir, "subscriptions.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = logFile.WriteString(`1a2b3c4d {"seq":2,"op":"save","key":"0x4`)
+	require.NoError(t, err)
+	require.NoError(t, logFile.Close())
+
+	subscriptions, err = NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	all, _ := subscriptions.GetAll()
+	assert.Equal(t, map[string]int64{"0x123": 100}, all)
+
+	subscriptions.Save("0x456", int64(200))
+	require.NoError(t, subscriptions.Close())
+
+	subscriptions, err = NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	defer subscriptions.Close()
+	all, _ = subscriptions.GetAll()
+	assert.Equal(t, map[string]int64{"0x123": 100, "0x456": 200}, all)
+}
+
+// failingLog writes half of the next record and then fails, like a full disk.
+type failingLog struct {
+	*os.File
+	fail bool
+}
+
+func (f *failingLog) WriteString(s string) (int, error) {
+	if !f.fail {
+		return f.File.WriteString(s)
+	}
+	f.fail = false
+	n, _ := f.File.WriteString(s[:len(s)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestDiskStorageCutsFailedAppend(t *testing.T) {
+	dir := t.TempDir()
+
+	subscriptions, err := NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, subscriptions.Save("0x123", int64(100)))
+	log := &failingLog{File: subscriptions.log.(*os.File), fail: true}
+	subscriptions.log = log
+
+	assert.Error(t, subscriptions.Save("0x456", int64(200)))
+	_, exists, _ := subscriptions.Find("0x456")
+	assert.False(t, exists, "a record that is not durable is not applied")
+	require.NoError(t, subscriptions.Save("0x789", int64(300)))
+	require.NoError(t, subscriptions.Close())
+
+	subscriptions, err = NewDiskSubscriptionStorage(dir)
+	require.NoError(t, err)
+	defer subscriptions.Close()
+	all, _ := subscriptions.GetAll()
+	assert.Equal(t, map[string]int64{"0x123": 100, "0x789": 300}, all, "records written after a failed one survive a restart")
+}
+
+func TestDiskStorageSkipsRecordsCoveredBySnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	transactions, err := NewDiskTransactionStorage(dir)
+	require.NoError(t, err)
+	transactions.Append("0x123", []entities.Transaction{{Hash: "h1"}})
+	transactions.Append("0x123", []entities.Transaction{{Hash: "h2"}})
+	logBeforeCompaction, err := os.ReadFile(filepath.Join(dir, "transactions.log"))
+	require.NoError(t, err)
+	require.NoError(t, transactions.Compact())
+	require.NoError(t, transactions.Close())
+
+	// Simulate a crash after the snapshot was renamed but before the log was truncated
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "transactions.log"), logBeforeCompaction, 0o644))
+
+	transactions, err = NewDiskTransactionStorage(dir)
+	require.NoError(t, err)
+	defer transactions.Close()
+	stored, _, _ := transactions.Find("0x123")
+	assert.Equal(t, []entities.Transaction{{Hash: "h1"}, {Hash: "h2"}}, stored, "appends must not be replayed twice")
+}
+
+// TestDiskStorageRecoversFromKilledProcess kills a process writing in a loop and checks the
+// recovered state is an uninterrupted prefix of what it wrote.
+func TestDiskStorageRecoversFromKilledProcess(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns a writer process")
+	}
+	dir := t.TempDir()
+
+	for round := 0; round < 3; round++ {
+		cmd := exec.Command(os.Args[0], "-test.run=TestDiskStorageWriterProcess")
+		cmd.Env = append(os.Environ(), "DISK_STORAGE_WRITER_DIR="+dir)
+		require.NoError(t, cmd.Start())
+		time.Sleep(300 * time.Millisecond)
+		require.NoError(t, cmd.Process.Kill())
+		cmd.Wait()
+
+		transactions, err := NewDiskTransactionStorage(dir)
+		require.NoError(t, err)
+		written, _, _ := transactions.Find("0x123")
+		require.NotEmpty(t, written)
+		for i, tx := range written {
+			require.Equal(t, strconv.Itoa(i), tx.Hash, "recovered transactions must be contiguous")
+		}
+		require.NoError(t, transactions.Close())
+	}
+}
+
+// TestDiskStorageWriterProcess is run as a separate process by TestDiskStorageRecoversFromKilledProcess.
+func TestDiskStorageWriterProcess(t *testing.T) {
+	dir := os.Getenv("DISK_STORAGE_WRITER_DIR")
+	if dir == "" {
+		t.Skip("only runs as a helper process")
+	}
+
+	transactions, err := NewDiskTransactionStorage(dir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	transactions.CompactEvery = 50
+
+	next := 0
+	if stored, exists, _ := transactions.Find("0x123"); exists {
+		next = len(stored)
+	}
+	for i := next; ; i++ {
+		transactions.Append("0x123", []entities.Transaction{{Hash: strconv.Itoa(i)}})
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := 0
+	for _, b := range data {
+		if b == '\n' {
+			lines++
+		}
+	}
+	return lines
+}
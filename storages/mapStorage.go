@@ -0,0 +1,121 @@
+package storages
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// ErrNotFound is returned when updating a key that does not exist.
+var ErrNotFound = errors.New("key not found")
+
+// MapStorage is a typed in-memory storage safe for concurrent use.
+type MapStorage[K comparable, V any] struct {
+	items map[K]V
+	equal func(a, b V) bool
+	mu    sync.RWMutex
+}
+
+// Ensures that MapStorage implements Storage
+var _ interfaces.Storage[string, int64] = (*MapStorage[string, int64])(nil)
+
+// NewMapStorage creates an empty storage, equal is used by CompareAndSwap and defaults to reflect.DeepEqual.
+func NewMapStorage[K comparable, V any](equal func(a, b V) bool) *MapStorage[K, V] {
+	if equal == nil {
+		equal = func(a, b V) bool {
+			return reflect.DeepEqual(a, b)
+		}
+	}
+	return &MapStorage[K, V]{
+		items: make(map[K]V),
+		equal: equal,
+	}
+}
+
+func (s *MapStorage[K, V]) Save(key K, value V) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[key] = value
+	return nil
+}
+
+func (s *MapStorage[K, V]) Delete(key K) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, key)
+	return nil
+}
+
+func (s *MapStorage[K, V]) Find(key K) (V, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, exists := s.items[key]
+	return value, exists, nil
+}
+
+func (s *MapStorage[K, V]) Update(key K, value V) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.items[key]; !exists {
+		return ErrNotFound
+	}
+	s.items[key] = value
+	return nil
+}
+
+func (s *MapStorage[K, V]) GetAll() (map[K]V, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Copy to prevent external modifications
+	c := make(map[K]V, len(s.items))
+	for k, v := range s.items {
+		c[k] = v
+	}
+	return c, nil
+}
+
+// Len returns the number of entries without copying them.
+func (s *MapStorage[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+func (s *MapStorage[K, V]) Range(fn func(key K, value V) bool) error {
+	// Iterate over a copy so fn can write to the storage
+	all, _ := s.GetAll()
+	for k, v := range all {
+		if !fn(k, v) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MapStorage[K, V]) CompareAndSwap(key K, old V, new V) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.items[key]
+	if !exists || !s.equal(current, old) {
+		return false, nil
+	}
+	s.items[key] = new
+	return true, nil
+}
+
+// modify atomically replaces the value of key with the result of fn.
+func (s *MapStorage[K, V]) modify(key K, fn func(current V, exists bool) V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.items[key]
+	s.items[key] = fn(current, exists)
+}
@@ -1,19 +1,33 @@
 package storages
 
 import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
 )
 
 // MemoryStorage aggregates different types of storages.
 type MemoryStorage struct {
-	Subscriptions interfaces.Storage
-	Transactions  interfaces.Storage
+	Subscriptions interfaces.Storage[string, int64]
+	Transactions  interfaces.TransactionStorage
+	Streams       interfaces.Storage[string, entities.Stream]
+	Backfills     interfaces.Storage[string, entities.Backfill]
+	Pending       interfaces.Storage[string, entities.PendingTransaction]
+	Webhooks      interfaces.Storage[string, entities.Webhook]
+	DeadLetters   interfaces.Storage[string, entities.DeadLetter]
+	Devices       interfaces.Storage[string, []entities.Device]
 }
 
-// NewMemoryStorage creates a new MemoryStorage instance with initialized sub-storages.
-func NewMemoryStorage(subs interfaces.Storage, trans interfaces.Storage) *MemoryStorage {
+// NewMemoryStorage creates a new MemoryStorage instance keeping every sub-storage in memory. Callers
+// needing other implementations replace the fields, or build the struct themselves.
+func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		Subscriptions: subs,
-		Transactions:  trans,
+		Subscriptions: NewSubscriptionStorage(),
+		Transactions:  NewTransactionStorage(),
+		Streams:       NewStreamStorage(),
+		Backfills:     NewBackfillStorage(),
+		Pending:       NewPendingStorage(),
+		Webhooks:      NewWebhookStorage(),
+		DeadLetters:   NewDeadLetterStorage(),
+		Devices:       NewDeviceStorage(),
 	}
 }
@@ -0,0 +1,16 @@
+package storages
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// PendingStorage manages the mempool transactions of subscribed addresses, keyed by hash.
+type PendingStorage = MapStorage[string, entities.PendingTransaction]
+
+// Ensures that PendingStorage implements Storage
+var _ interfaces.Storage[string, entities.PendingTransaction] = (*PendingStorage)(nil)
+
+func NewPendingStorage() *PendingStorage {
+	return NewMapStorage[string, entities.PendingTransaction](nil)
+}
@@ -0,0 +1,16 @@
+package storages
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// StreamStorage manages the delivery state of each address.
+type StreamStorage = MapStorage[string, entities.Stream]
+
+// Ensures that StreamStorage implements Storage
+var _ interfaces.Storage[string, entities.Stream] = (*StreamStorage)(nil)
+
+func NewStreamStorage() *StreamStorage {
+	return NewMapStorage[string, entities.Stream](nil)
+}
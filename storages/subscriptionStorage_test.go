@@ -9,81 +9,122 @@ import (
 
 // TestSubscriptionStorageSave tests the Save method of SubscriptionStorage.
 func TestSubscriptionStorageSave(t *testing.T) {
-	storage := &SubscriptionStorage{
-		subscriptions: make(map[string]int64),
-	}
+	storage := NewSubscriptionStorage()
 
 	// Test saving a new key-value pair
-	storage.Save("user1", int64(1234567890))
-	val, exists := storage.subscriptions["user1"]
+	require.NoError(t, storage.Save("user1", int64(1234567890)))
+	val, exists := storage.items["user1"]
 	require.True(t, exists, "The key should exist after saving.")
 	assert.Equal(t, int64(1234567890), val, "The value should match the saved value.")
-
-	// Test saving with a non-int64 value (should not save)
-	storage.Save("user2", "not-an-int64")
-	_, exists = storage.subscriptions["user2"]
-	assert.False(t, exists, "The key should not exist as the value was not an int64.")
 }
 
 // TestSubscriptionStorageDelete tests the Delete method.
 func TestSubscriptionStorageDelete(t *testing.T) {
-	storage := &SubscriptionStorage{
-		subscriptions: map[string]int64{"user1": 1234567890},
-	}
+	storage := NewSubscriptionStorage()
+	storage.items["user1"] = 1234567890
 
 	// Test deleting an existing key
-	storage.Delete("user1")
-	_, exists := storage.subscriptions["user1"]
+	require.NoError(t, storage.Delete("user1"))
+	_, exists := storage.items["user1"]
 	assert.False(t, exists, "The key should no longer exist.")
 
 	// Test deleting a non-existing key
-	storage.Delete("user2")
-	_, exists = storage.subscriptions["user2"]
+	require.NoError(t, storage.Delete("user2"))
+	_, exists = storage.items["user2"]
 	assert.False(t, exists, "The key should not exist as it was never added.")
 }
 
 // TestSubscriptionStorageFind tests the Find method.
 func TestSubscriptionStorageFind(t *testing.T) {
-	storage := &SubscriptionStorage{
-		subscriptions: map[string]int64{"user1": 1234567890},
-	}
+	storage := NewSubscriptionStorage()
+	storage.items["user1"] = 1234567890
 
 	// Test finding an existing key
-	value, exists := storage.Find("user1")
+	value, exists, err := storage.Find("user1")
+	require.NoError(t, err)
 	assert.True(t, exists, "The key should exist.")
-	assert.Equal(t, int64(1234567890), value.(int64), "The value should match.")
+	assert.Equal(t, int64(1234567890), value, "The value should match.")
 
 	// Test finding a non-existing key
-	_, exists = storage.Find("nonexistent")
+	_, exists, err = storage.Find("nonexistent")
+	require.NoError(t, err)
 	assert.False(t, exists, "The key should not exist.")
 }
 
 // TestSubscriptionStorageUpdate tests the Update method.
 func TestSubscriptionStorageUpdate(t *testing.T) {
-	storage := &SubscriptionStorage{
-		subscriptions: map[string]int64{"user1": 1234567890},
-	}
+	storage := NewSubscriptionStorage()
+	storage.items["user1"] = 1234567890
 
 	// Test updating an existing key
-	storage.Update("user1", int64(987654321))
-	val, exists := storage.subscriptions["user1"]
+	require.NoError(t, storage.Update("user1", int64(987654321)))
+	val, exists := storage.items["user1"]
 	assert.True(t, exists, "The key should still exist after update.")
 	assert.Equal(t, int64(987654321), val, "The value should be updated.")
 
 	// Test updating a non-existing key
-	storage.Update("user2", int64(555555555))
-	_, exists = storage.subscriptions["user2"]
+	err := storage.Update("user2", int64(555555555))
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, exists = storage.items["user2"]
 	assert.False(t, exists, "Update should not create a new key.")
 }
 
 // TestSubscriptionStorageGetAll tests the GetAll method.
 func TestSubscriptionStorageGetAll(t *testing.T) {
-	storage := &SubscriptionStorage{
-		subscriptions: map[string]int64{"user1": 1234567890, "user2": 987654321},
-	}
+	storage := NewSubscriptionStorage()
+	storage.items["user1"] = 1234567890
+	storage.items["user2"] = 987654321
 
-	allSubs := storage.GetAll().(map[string]int64)
+	allSubs, err := storage.GetAll()
+	require.NoError(t, err)
 	assert.Equal(t, 2, len(allSubs), "There should be two entries in the map.")
 	assert.Equal(t, int64(1234567890), allSubs["user1"], "The value for 'user1' should match.")
 	assert.Equal(t, int64(987654321), allSubs["user2"], "The value for 'user2' should match.")
+
+	// Test the returned map is a copy
+	allSubs["user3"] = 1
+	_, exists := storage.items["user3"]
+	assert.False(t, exists, "Changing the result should not change the storage.")
+}
+
+// TestSubscriptionStorageRange tests the Range method.
+func TestSubscriptionStorageRange(t *testing.T) {
+	storage := NewSubscriptionStorage()
+	storage.items["user1"] = 1
+	storage.items["user2"] = 2
+
+	visited := map[string]int64{}
+	require.NoError(t, storage.Range(func(key string, value int64) bool {
+		visited[key] = value
+		// Writing from the callback must not deadlock
+		storage.Save(key, value+1)
+		return true
+	}))
+	assert.Equal(t, map[string]int64{"user1": 1, "user2": 2}, visited)
+	assert.Equal(t, int64(2), storage.items["user1"])
+
+	calls := 0
+	storage.Range(func(key string, value int64) bool {
+		calls++
+		return false
+	})
+	assert.Equal(t, 1, calls, "Range should stop when fn returns false.")
+}
+
+// TestSubscriptionStorageCompareAndSwap tests the CompareAndSwap method.
+func TestSubscriptionStorageCompareAndSwap(t *testing.T) {
+	storage := NewSubscriptionStorage()
+	storage.items["user1"] = 100
+
+	swapped, err := storage.CompareAndSwap("user1", 100, 200)
+	require.NoError(t, err)
+	assert.True(t, swapped, "The value should be swapped when it matches.")
+	assert.Equal(t, int64(200), storage.items["user1"])
+
+	swapped, _ = storage.CompareAndSwap("user1", 100, 300)
+	assert.False(t, swapped, "A stale old value should not be swapped.")
+	assert.Equal(t, int64(200), storage.items["user1"])
+
+	swapped, _ = storage.CompareAndSwap("user2", 0, 1)
+	assert.False(t, swapped, "A missing key should not be created.")
 }
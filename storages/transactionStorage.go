@@ -1,74 +1,34 @@
 package storages
 
 import (
-	"sync"
-
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
 )
 
 // TransactionStorage manages transactions data.
 type TransactionStorage struct {
-	transactions map[string][]entities.Transaction
-	mu           sync.RWMutex
+	*MapStorage[string, []entities.Transaction]
 }
 
-// Ensures that TransactionStorage implements Storage
-var _ interfaces.Storage = (*TransactionStorage)(nil)
-
-// TransactionStorage methods
+// Ensures that TransactionStorage implements TransactionStorage
+var _ interfaces.TransactionStorage = (*TransactionStorage)(nil)
 
 func NewTransactionStorage() *TransactionStorage {
 	return &TransactionStorage{
-		transactions: make(map[string][]entities.Transaction),
-	}
-}
-
-func (t *TransactionStorage) Save(key string, value interface{}) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	// Saves the value to the map if it is of the correct type ([]entities.Transaction)
-	if newTransactions, ok := value.([]entities.Transaction); ok {
-		t.transactions[key] = append(t.transactions[key], newTransactions...)
+		MapStorage: NewMapStorage[string, []entities.Transaction](nil),
 	}
 }
 
-func (t *TransactionStorage) Delete(key string) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	if _, exists := t.transactions[key]; exists {
-		delete(t.transactions, key)
-	}
+func (t *TransactionStorage) Append(key string, transactions []entities.Transaction) error {
+	t.modify(key, func(current []entities.Transaction, exists bool) []entities.Transaction {
+		return appendTransactions(current, transactions)
+	})
+	return nil
 }
 
-func (t *TransactionStorage) Find(key string) (interface{}, bool) {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	if value, exists := t.transactions[key]; exists {
-		return value, true
-	}
-	return nil, false
-}
-
-func (t *TransactionStorage) Update(key string, value interface{}) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	if val, ok := value.([]entities.Transaction); ok {
-		if _, exists := t.transactions[key]; exists {
-			t.transactions[key] = val
-		}
-	}
-}
-
-func (t *TransactionStorage) GetAll() interface{} {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-
-	// Copy to prevent external modifications
-	c := make(map[string][]entities.Transaction)
-	for k, v := range t.transactions {
-		c[k] = v
-	}
-	return c
+// appendTransactions never writes into the spare capacity of current, which readers may share.
+func appendTransactions(current []entities.Transaction, added []entities.Transaction) []entities.Transaction {
+	merged := make([]entities.Transaction, 0, len(current)+len(added))
+	merged = append(merged, current...)
+	return append(merged, added...)
 }
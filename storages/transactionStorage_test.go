@@ -5,87 +5,103 @@ import (
 
 	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTransactionStorageSave(t *testing.T) {
-	storage := &TransactionStorage{
-		transactions: make(map[string][]entities.Transaction),
-	}
+	storage := NewTransactionStorage()
 
 	// Test saving transactions
 	transactions := []entities.Transaction{{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}}
-	storage.Save("tx1", transactions)
-	assert.Equal(t, transactions, storage.transactions["tx1"], "Transactions should match the saved transactions.")
+	require.NoError(t, storage.Save("tx1", transactions))
+	assert.Equal(t, transactions, storage.items["tx1"], "Transactions should match the saved transactions.")
 
-	// Test saving with incorrect type
-	storage.Save("tx2", "incorrect type")
-	_, exists := storage.transactions["tx2"]
-	assert.False(t, exists, "No transaction should be saved with incorrect type.")
+	// Test saving again replaces the transactions
+	replaced := []entities.Transaction{{From: "addr2", To: "addr3", Value: "200", Hash: "hash2"}}
+	require.NoError(t, storage.Save("tx1", replaced))
+	assert.Equal(t, replaced, storage.items["tx1"], "Save should replace the stored transactions.")
+}
+
+func TestTransactionStorageAppend(t *testing.T) {
+	storage := NewTransactionStorage()
+
+	first := []entities.Transaction{{Hash: "hash1"}}
+	require.NoError(t, storage.Append("tx1", first))
+	require.NoError(t, storage.Append("tx1", []entities.Transaction{{Hash: "hash2"}}))
+	assert.Equal(t, []entities.Transaction{{Hash: "hash1"}, {Hash: "hash2"}}, storage.items["tx1"], "Append should keep the existing transactions.")
+	assert.Equal(t, []entities.Transaction{{Hash: "hash1"}}, first, "Append should not modify the caller's slice.")
 }
 
 func TestTransactionStorageDelete(t *testing.T) {
-	storage := &TransactionStorage{
-		transactions: map[string][]entities.Transaction{
-			"tx1": {{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}},
-		},
-	}
+	storage := NewTransactionStorage()
+	storage.items["tx1"] = []entities.Transaction{{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}}
 
 	// Test deleting an existing transaction
-	storage.Delete("tx1")
-	_, exists := storage.transactions["tx1"]
+	require.NoError(t, storage.Delete("tx1"))
+	_, exists := storage.items["tx1"]
 	assert.False(t, exists, "The key should no longer exist.")
 
 	// Test deleting a non-existing transaction
-	storage.Delete("tx2")
-	_, exists = storage.transactions["tx2"]
+	require.NoError(t, storage.Delete("tx2"))
+	_, exists = storage.items["tx2"]
 	assert.False(t, exists, "The key should not exist as it was never added.")
 }
 
 func TestTransactionStorageFind(t *testing.T) {
-	storage := &TransactionStorage{
-		transactions: map[string][]entities.Transaction{
-			"tx1": {{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}},
-		},
-	}
+	storage := NewTransactionStorage()
+	storage.items["tx1"] = []entities.Transaction{{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}}
 
 	// Test finding an existing transaction
-	value, exists := storage.Find("tx1")
+	value, exists, err := storage.Find("tx1")
+	require.NoError(t, err)
 	assert.True(t, exists, "The key should exist.")
-	assert.Equal(t, storage.transactions["tx1"], value, "The transactions should match.")
+	assert.Equal(t, storage.items["tx1"], value, "The transactions should match.")
 
 	// Test finding a non-existing transaction
-	_, exists = storage.Find("tx2")
+	_, exists, _ = storage.Find("tx2")
 	assert.False(t, exists, "The key should not exist.")
 }
 
 func TestTransactionStorageUpdate(t *testing.T) {
-	storage := &TransactionStorage{
-		transactions: map[string][]entities.Transaction{
-			"tx1": {{From: "addr1", To: "addr2", Value: "50", Hash: "hash1"}},
-		},
-	}
+	storage := NewTransactionStorage()
+	storage.items["tx1"] = []entities.Transaction{{From: "addr1", To: "addr2", Value: "50", Hash: "hash1"}}
 
 	// Test updating an existing transaction
 	newTransactions := []entities.Transaction{{From: "addr1", To: "addr3", Value: "150", Hash: "hash2"}}
-	storage.Update("tx1", newTransactions)
-	assert.Equal(t, newTransactions, storage.transactions["tx1"], "Transactions should be updated.")
+	require.NoError(t, storage.Update("tx1", newTransactions))
+	assert.Equal(t, newTransactions, storage.items["tx1"], "Transactions should be updated.")
 
 	// Test updating a non-existing transaction
-	storage.Update("tx2", newTransactions)
-	_, exists := storage.transactions["tx2"]
+	assert.ErrorIs(t, storage.Update("tx2", newTransactions), ErrNotFound)
+	_, exists := storage.items["tx2"]
 	assert.False(t, exists, "Update should not create a new key.")
 }
 
+func TestTransactionStorageCompareAndSwap(t *testing.T) {
+	storage := NewTransactionStorage()
+	old := []entities.Transaction{{Hash: "hash1"}, {Hash: "hash2"}}
+	storage.items["tx1"] = old
+
+	// A concurrent append makes the expected value stale
+	require.NoError(t, storage.Append("tx1", []entities.Transaction{{Hash: "hash3"}}))
+	swapped, err := storage.CompareAndSwap("tx1", old, old[1:])
+	require.NoError(t, err)
+	assert.False(t, swapped, "The swap should fail after a concurrent append.")
+
+	current, _, _ := storage.Find("tx1")
+	swapped, _ = storage.CompareAndSwap("tx1", current, current[1:])
+	assert.True(t, swapped)
+	assert.Equal(t, []entities.Transaction{{Hash: "hash2"}, {Hash: "hash3"}}, storage.items["tx1"])
+}
+
 func TestTransactionStorageGetAll(t *testing.T) {
-	storage := &TransactionStorage{
-		transactions: map[string][]entities.Transaction{
-			"tx1": {{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}},
-			"tx2": {{From: "addr2", To: "addr3", Value: "200", Hash: "hash2"}},
-		},
-	}
-
-	allTransactions := storage.GetAll().(map[string][]entities.Transaction)
+	storage := NewTransactionStorage()
+	storage.items["tx1"] = []entities.Transaction{{From: "addr1", To: "addr2", Value: "100", Hash: "hash1"}}
+	storage.items["tx2"] = []entities.Transaction{{From: "addr2", To: "addr3", Value: "200", Hash: "hash2"}}
+
+	allTransactions, err := storage.GetAll()
+	require.NoError(t, err)
 	assert.Equal(t, 2, len(allTransactions), "There should be two entries in the map.")
-	assert.Equal(t, storage.transactions["tx1"], allTransactions["tx1"], "The transactions for 'tx1' should match.")
-	assert.Equal(t, storage.transactions["tx2"], allTransactions["tx2"], "The transactions for 'tx2' should match.")
+	assert.Equal(t, storage.items["tx1"], allTransactions["tx1"], "The transactions for 'tx1' should match.")
+	assert.Equal(t, storage.items["tx2"], allTransactions["tx2"], "The transactions for 'tx2' should match.")
 }
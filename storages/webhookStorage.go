@@ -0,0 +1,26 @@
+package storages
+
+import (
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/entities"
+	"github.com/luisaugustmelo/trust-wallet-transaction-notifier/interfaces"
+)
+
+// WebhookStorage manages the webhooks of the consumers, keyed by address and consumer.
+type WebhookStorage = MapStorage[string, entities.Webhook]
+
+// Ensures that WebhookStorage implements Storage
+var _ interfaces.Storage[string, entities.Webhook] = (*WebhookStorage)(nil)
+
+func NewWebhookStorage() *WebhookStorage {
+	return NewMapStorage[string, entities.Webhook](nil)
+}
+
+// DeadLetterStorage manages the webhook payloads that could not be delivered, keyed by id.
+type DeadLetterStorage = MapStorage[string, entities.DeadLetter]
+
+// Ensures that DeadLetterStorage implements Storage
+var _ interfaces.Storage[string, entities.DeadLetter] = (*DeadLetterStorage)(nil)
+
+func NewDeadLetterStorage() *DeadLetterStorage {
+	return NewMapStorage[string, entities.DeadLetter](nil)
+}
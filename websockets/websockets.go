@@ -0,0 +1,373 @@
+// Package websockets implements the subset of RFC 6455 used by the notifier: text messages,
+// fragmentation, ping/pong and close, for both client and server connections.
+package websockets
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	// maxMessageSize bounds the memory a single peer message can use.
+	maxMessageSize = 16 << 20
+	// maxControlPayload is the largest payload RFC 6455 allows in a control frame.
+	maxControlPayload = 125
+	// closeTimeout bounds the close frame sent to a peer that may have stopped reading.
+	closeTimeout = time.Second
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// ErrClosed is returned by ReadMessage once the peer closed the connection.
+var ErrClosed = errors.New("websocket connection closed")
+
+// Conn is a WebSocket connection. Reads must happen from a single goroutine, writes are safe for
+// concurrent use.
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	client  bool
+	writeMu sync.Mutex
+}
+
+// Dial opens a client connection to a ws:// or wss:// URL.
+func Dial(rawURL string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: timeout}
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed with status %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &Conn{conn: conn, reader: reader, client: true}, nil
+}
+
+// Upgrade turns an incoming HTTP request into a server connection.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing websocket key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: rw.Reader}, nil
+}
+
+// ReadMessage returns the next text or binary message, answering pings along the way. Frames breaking
+// RFC 6455 fail the read, the caller is expected to close the connection then.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+			c.writeFrame(opClose, payload)
+			return nil, ErrClosed
+		case opText, opBinary, opContinuation:
+			if opcode == opContinuation && !started {
+				return nil, errors.New("unexpected continuation frame")
+			}
+			if opcode != opContinuation && started {
+				return nil, errors.New("expected continuation frame")
+			}
+			started = true
+			if len(message)+len(payload) > maxMessageSize {
+				return nil, errors.New("websocket message too large")
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", opcode)
+		}
+	}
+}
+
+// ReadJSON reads the next message and decodes it into v.
+func (c *Conn) ReadJSON(v interface{}) error {
+	message, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(message, v)
+}
+
+// WriteMessage sends data as a single text message.
+func (c *Conn) WriteMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// WriteJSON encodes v and sends it as a text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(data)
+}
+
+// Ping sends a ping control frame, the peer answers with a pong.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// SetReadDeadline bounds how long ReadMessage may block.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline bounds how long a write may block.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Close sends a close frame and closes the underlying connection. The deadline also unblocks a write
+// in progress, so a dead peer cannot hang it.
+func (c *Conn) Close() error {
+	c.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
+
+func (c *Conn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket frame uses reserved bits without an extension")
+	}
+	// Clients must mask every frame and servers must not
+	if masked == c.client {
+		return false, 0, nil, errors.New("websocket frame masking does not match the sender")
+	}
+	if opcode >= opClose && (!fin || length > maxControlPayload) {
+		return false, 0, nil, errors.New("websocket control frame is fragmented or too large")
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, errors.New("websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	frame := []byte{0x80 | opcode}
+	maskBit := byte(0)
+	if c.client {
+		// Frames sent by clients must always be masked
+		maskBit = 0x80
+	}
+
+	length := len(payload)
+	switch {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		var extended [8]byte
+		binary.BigEndian.PutUint64(extended[:], uint64(length))
+		frame = append(frame, maskBit|127)
+		frame = append(frame, extended[:]...)
+	}
+
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := start; i < len(frame); i++ {
+			frame[i] ^= mask[(i-start)%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContains(header http.Header, name string, value string) bool {
+	for _, field := range header.Values(name) {
+		for _, token := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
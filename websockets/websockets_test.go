@@ -0,0 +1,109 @@
+package websockets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(message); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestDialAndEcho(t *testing.T) {
+	server := newEchoServer(t)
+	defer server.Close()
+
+	conn, err := Dial("ws"+strings.TrimPrefix(server.URL, "http"), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Covers the 7-bit, 16-bit and 64-bit payload length encodings
+	for _, size := range []int{5, 300, 70000} {
+		message := strings.Repeat("x", size)
+		require.NoError(t, conn.WriteMessage([]byte(message)))
+		echoed, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, message, string(echoed))
+	}
+
+	require.NoError(t, conn.WriteJSON(map[string]string{"method": "ping"}))
+	var reply map[string]string
+	require.NoError(t, conn.ReadJSON(&reply))
+	assert.Equal(t, "ping", reply["method"])
+}
+
+func TestReadMessageReturnsErrClosed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer server.Close()
+
+	conn, err := Dial("ws"+strings.TrimPrefix(server.URL, "http"), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.ReadMessage()
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestServerRejectsInvalidFrames(t *testing.T) {
+	for name, send := range map[string]func(conn *Conn) error{
+		"unmasked": func(conn *Conn) error {
+			conn.client = false
+			return conn.WriteMessage([]byte("hello"))
+		},
+		"oversized control": func(conn *Conn) error {
+			return conn.writeFrame(opPing, make([]byte, maxControlPayload+1))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newEchoServer(t)
+			defer server.Close()
+
+			conn, err := Dial("ws"+strings.TrimPrefix(server.URL, "http"), time.Second)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			require.NoError(t, send(conn))
+			conn.client = true
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = conn.ReadMessage()
+			assert.ErrorIs(t, err, ErrClosed, "the server should close the connection instead of answering")
+		})
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	server := newEchoServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}